@@ -1,32 +1,147 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	_ "time/tzdata"
 
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/cache"
 	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
 	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/grafana"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
 	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/slack"
 )
 
 func main() {
-	log.Println(os.Getenv("CONFIG_FILE"))
-	if err := config.Load(os.Getenv("CONFIG_FILE")); err != nil {
-		log.Println(err.Error())
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validate(os.Args[2:]))
+	}
+	log.SetFlags(0)
+	log.SetOutput(logging.Writer(logging.LevelError))
+	ctx := context.Background()
+	configFile := os.Getenv("CONFIG_FILE")
+	logging.Info(ctx, "loading config", "file", configFile)
+	if err := config.Load(configFile); err != nil {
+		logging.Error(ctx, "cannot load config", "err", err)
+		panic(err)
+	}
+	cfg := config.Current()
+	if err := logging.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
 		panic(err)
 	}
-	g := grafana.NewClient(config.Global.Grafana.Endpoint)
-	if config.Global.Grafana.UseClientAuth {
-		if err := g.LoadP12(config.Global.Grafana.ClientAuthP12, os.Getenv("CLIENT_AUTH_PASSWORD")); err != nil {
+	var renderCache cache.Cache
+	if c := cfg.Cache; c.Backend != "" {
+		maxBytes := int64(c.MaxSizeMB) << 20
+		if c.Backend == config.CacheBackendDisk {
+			disk, err := cache.NewDisk(c.Dir, c.TTL.Duration(), maxBytes)
+			if err != nil {
+				panic(err)
+			}
+			renderCache = disk
+		} else {
+			renderCache = cache.NewMemory(c.TTL.Duration(), c.MaxEntries, maxBytes)
+		}
+	}
+	backends := grafana.Backends{}
+	for _, b := range cfg.Backends() {
+		g := grafana.NewClient(b.Endpoint)
+		g.SetConnectTimeout(cfg.Grafana.ConnectTimeout.Duration())
+		if err := g.SetTLS(b.TLS.CAFile, b.TLS.ServerName, b.TLS.InsecureSkipVerify); err != nil {
 			panic(err)
 		}
+		if b.UseClientAuth {
+			if err := g.LoadP12(b.ClientAuthP12, b.ClientAuthPassword); err != nil {
+				panic(err)
+			}
+		}
+		if renderCache != nil {
+			g.SetCache(renderCache, cfg.Cache.Step.Duration())
+		}
+		configureGrafana(g, cfg, &b)
+		backends[b.Name] = g
 	}
-	apiKey := os.Getenv("GRAFANA_API_KEY")
-	if apiKey != "" {
-		g.SetAPIKey(apiKey)
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	if cfg.Discovery.Enabled {
+		backends[cfg.Discovery.Grafana].StartDiscovery(ctx, &cfg.Discovery)
 	}
-	server := slack.NewSlackServer(g, config.Global.Slack.Token, config.Global.Slack.Secret, config.Global.Slack.Addr)
-	if err := server.Start(); err != nil {
-		panic(err)
+	server := slack.NewSlackServer(backends, cfg.Slack.Token, cfg.Slack.Secret, cfg.Slack.Addr)
+	config.Watch(ctx, configFile, func(c *config.Config) {
+		if err := logging.Setup(c.Log.Level, c.Log.Format); err != nil {
+			logging.Error(ctx, "cannot set up logging", "err", err)
+		}
+		for _, b := range c.Backends() {
+			if g, ok := backends[b.Name]; ok {
+				configureGrafana(g, c, &b)
+			}
+		}
+		server.Reload(c)
+	})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Start()
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			panic(err)
+		}
+	case <-ctx.Done():
+		logging.Info(context.Background(), "shutting down")
+		if err := server.Shutdown(config.Current().Slack.GracePeriod.Duration()); err != nil {
+			logging.Error(context.Background(), "shutdown", "err", err)
+		}
+	}
+}
+
+// configureGrafana applies the settings of a Grafana backend which a reload may change.
+func configureGrafana(g *grafana.Client, c *config.Config, b *config.NamedBackend) {
+	g.Configure(grafana.Settings{
+		Endpoint:      b.Endpoint,
+		APIKey:        b.BearerToken(),
+		Username:      b.Username,
+		Password:      b.Password,
+		RenderTimeout: c.Grafana.RenderTimeout.Duration(),
+		Retry:         c.Retry.Grafana.Policy(),
+	})
+}
+
+// validate checks config files without starting the server, like `grasla validate config.yaml` in CI.
+// Secrets are only read with --resolve-secrets, where the server's files and environment are available.
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: grasla validate [--resolve-secrets] <file>...")
+		flags.PrintDefaults()
+	}
+	resolveSecrets := flags.Bool("resolve-secrets", false, "read the secret files and environment variables")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		flags.Usage()
+		return 2
+	}
+	status := 0
+	for _, file := range files {
+		var err error
+		if *resolveSecrets {
+			_, err = config.Parse(file)
+		} else {
+			err = config.Check(file)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			status = 1
+			continue
+		}
+		fmt.Printf("%s: ok\n", file)
 	}
+	return status
 }
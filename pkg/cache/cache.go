@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache keeps rendered images for a while.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+}
+
+type entry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// Memory is an in-memory cache evicting the least recently used entries beyond its caps.
+type Memory struct {
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+}
+
+func NewMemory(ttl time.Duration, maxEntries int, maxBytes int64) *Memory {
+	return &Memory{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (m *Memory) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.Value.(*entry).expires) {
+		m.remove(e)
+		return nil, false
+	}
+	m.lru.MoveToFront(e)
+	return e.Value.(*entry).data, true
+}
+
+func (m *Memory) Set(key string, data []byte) {
+	if int64(len(data)) > m.maxBytes {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok {
+		m.remove(e)
+	}
+	m.entries[key] = m.lru.PushFront(&entry{key: key, data: data, expires: time.Now().Add(m.ttl)})
+	m.size += int64(len(data))
+	for m.lru.Len() > m.maxEntries || m.size > m.maxBytes {
+		m.remove(m.lru.Back())
+	}
+}
+
+func (m *Memory) remove(e *list.Element) {
+	v := m.lru.Remove(e).(*entry)
+	delete(m.entries, v.key)
+	m.size -= int64(len(v.data))
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+)
+
+// Disk is a cache of files in a directory, so that it survives restarts. The oldest
+// files are removed beyond its size cap.
+type Disk struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+
+	mu sync.Mutex
+}
+
+func NewDisk(dir string, ttl time.Duration, maxBytes int64) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &Disk{dir: dir, ttl: ttl, maxBytes: maxBytes}, nil
+}
+
+func (d *Disk) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".png")
+}
+
+func (d *Disk) Get(key string) ([]byte, bool) {
+	name := d.path(key)
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, false
+	}
+	if time.Since(info.ModTime()) > d.ttl {
+		os.Remove(name)
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (d *Disk) Set(key string, data []byte) {
+	if int64(len(data)) > d.maxBytes {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := ioutil.TempFile(d.dir, ".tmp-")
+	if err != nil {
+		logging.Error(context.Background(), "cannot write to the disk cache", "err", err)
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	name := d.path(key)
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		logging.Error(context.Background(), "cannot write to the disk cache", "err", err)
+		return
+	}
+	d.evict(filepath.Base(name))
+}
+
+// evict removes expired files, then the oldest ones until the directory fits in maxBytes.
+// The file just written is kept.
+func (d *Disk) evict(keep string) {
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		logging.Error(context.Background(), "cannot read the disk cache", "err", err)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+	var size int64
+	for _, f := range files {
+		if f.Name() == keep {
+			size += f.Size()
+		}
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".png" || f.Name() == keep {
+			continue
+		}
+		size += f.Size()
+		if size > d.maxBytes || time.Since(f.ModTime()) > d.ttl {
+			os.Remove(filepath.Join(d.dir, f.Name()))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AccessAllow = "allow"
+	AccessDeny  = "deny"
+)
+
+// Access decides who may render which aliases. The first rule matching both the alias
+// and the requester applies, otherwise Default, which allows unless set to deny.
+type Access struct {
+	Default string       `yaml:"default"`
+	Rules   []AccessRule `yaml:"rules"`
+}
+
+// AccessRule matches aliases by glob patterns like `billing-*`, every alias when empty.
+// A requester matches when it is in each list given: one of the channels, one of the
+// users, a member of one of the user groups and in one of the workspaces.
+type AccessRule struct {
+	Effect     string   `yaml:"effect"`
+	Aliases    []string `yaml:"aliases"`
+	Channels   []string `yaml:"channels"`
+	Users      []string `yaml:"users"`
+	Usergroups []string `yaml:"usergroups"`
+	Workspaces []string `yaml:"workspaces"`
+}
+
+// Subject is who asks for a graph and where.
+type Subject struct {
+	Workspace string
+	Channel   string
+	User      string
+	// InUsergroup reports whether User is a member of the user group.
+	InUsergroup func(usergroup string) (bool, error)
+}
+
+func (a *Access) validate() error {
+	switch a.Default {
+	case "", AccessAllow, AccessDeny:
+	default:
+		return invalid("default", errors.Errorf("must be allow or deny, got %q", a.Default))
+	}
+	for i, r := range a.Rules {
+		if r.Effect != AccessAllow && r.Effect != AccessDeny {
+			return invalid("rules", invalid(i, invalid("effect", errors.Errorf("must be allow or deny, got %q", r.Effect))))
+		}
+		for j, p := range r.Aliases {
+			if _, err := path.Match(p, ""); err != nil {
+				return invalid("rules", invalid(i, invalid("aliases", invalid(j, errors.Errorf("invalid pattern %q", p)))))
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether subject may render name. A group is allowed when the group
+// and every alias in it are.
+func Allowed(name string, subject *Subject) bool {
+	access := &Current().Access
+	if !access.allowed(name, subject) {
+		return false
+	}
+	if g, err := GetGroup(name); err == nil {
+		for _, v := range g.Dashboards {
+			if !access.allowed(v, subject) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (a *Access) allowed(name string, subject *Subject) bool {
+	for _, r := range a.Rules {
+		if r.matches(name, subject) {
+			return r.Effect == AccessAllow
+		}
+	}
+	return a.Default != AccessDeny
+}
+
+func (r *AccessRule) matches(name string, subject *Subject) bool {
+	if len(r.Aliases) > 0 && !matchAny(r.Aliases, name) {
+		return false
+	}
+	if len(r.Channels) > 0 && !contains(r.Channels, subject.Channel) {
+		return false
+	}
+	if len(r.Users) > 0 && !contains(r.Users, subject.User) {
+		return false
+	}
+	if len(r.Workspaces) > 0 && !contains(r.Workspaces, subject.Workspace) {
+		return false
+	}
+	if len(r.Usergroups) > 0 {
+		for _, g := range r.Usergroups {
+			member, err := subject.InUsergroup(g)
+			if err != nil {
+				// Unknown membership fails closed: deny rules apply and allow rules do not.
+				return r.Effect == AccessDeny
+			}
+			if member {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+// testSubject is in the user groups mapped to true, and its lookup fails for the others.
+func testSubject(channel, user string, usergroups map[string]bool) *Subject {
+	return &Subject{
+		Workspace: "T1",
+		Channel:   channel,
+		User:      user,
+		InUsergroup: func(usergroup string) (bool, error) {
+			member, ok := usergroups[usergroup]
+			if !ok {
+				return false, errors.New("usergroups.users.list failed")
+			}
+			return member, nil
+		},
+	}
+}
+
+func TestAccessAllowed(t *testing.T) {
+	access := Access{
+		Rules: []AccessRule{
+			{Effect: AccessDeny, Aliases: []string{"billing-*"}, Channels: []string{"C-random"}},
+			{Effect: AccessAllow, Aliases: []string{"billing-*"}, Usergroups: []string{"S-finance", "S-admins"}},
+			{Effect: AccessDeny, Aliases: []string{"billing-*"}},
+			{Effect: AccessDeny, Aliases: []string{"secret"}, Usergroups: []string{"S-contractors"}},
+			{Effect: AccessAllow, Aliases: []string{"prod-?"}, Users: []string{"U-ops"}, Workspaces: []string{"T1"}},
+			{Effect: AccessDeny, Aliases: []string{"prod-?"}},
+		},
+	}
+	tests := []struct {
+		name    string
+		subject *Subject
+		want    bool
+	}{
+		{"cpu", testSubject("C-random", "U-any", nil), true},
+		{"billing-cost", testSubject("C-finance", "U-any", map[string]bool{"S-finance": true, "S-admins": false}), true},
+		{"billing-cost", testSubject("C-finance", "U-any", map[string]bool{"S-finance": false, "S-admins": true}), true},
+		{"billing-cost", testSubject("C-finance", "U-any", map[string]bool{"S-finance": false, "S-admins": false}), false},
+		// The first matching rule applies, even when a later one would allow.
+		{"billing-cost", testSubject("C-random", "U-any", map[string]bool{"S-finance": true}), false},
+		// A failed lookup does not match allow rules, so the deny rule after it applies.
+		{"billing-cost", testSubject("C-finance", "U-any", nil), false},
+		{"billing-cost", testSubject("C-finance", "U-any", map[string]bool{"S-finance": false}), false},
+		// A failed lookup matches deny rules.
+		{"secret", testSubject("C-finance", "U-any", nil), false},
+		{"secret", testSubject("C-finance", "U-any", map[string]bool{"S-contractors": false}), true},
+		{"secret", testSubject("C-finance", "U-any", map[string]bool{"S-contractors": true}), false},
+		{"prod-1", testSubject("C-ops", "U-ops", nil), true},
+		{"prod-1", testSubject("C-ops", "U-dev", nil), false},
+		{"prod-12", testSubject("C-ops", "U-dev", nil), true},
+	}
+	for _, tt := range tests {
+		if got := access.allowed(tt.name, tt.subject); got != tt.want {
+			t.Errorf("allowed(%q, channel %s) = %t, want %t", tt.name, tt.subject.Channel, got, tt.want)
+		}
+	}
+
+	deny := Access{Default: AccessDeny, Rules: []AccessRule{{Effect: AccessAllow, Channels: []string{"C-ops"}}}}
+	if !deny.allowed("cpu", testSubject("C-ops", "U-any", nil)) {
+		t.Error("allowed(cpu, C-ops) = false with an allow rule, want true")
+	}
+	if deny.allowed("cpu", testSubject("C-random", "U-any", nil)) {
+		t.Error("allowed(cpu, C-random) = true with default deny, want false")
+	}
+}
+
+func TestAllowedGroup(t *testing.T) {
+	old := Current()
+	defer func() {
+		if old != nil {
+			Apply(old)
+		}
+	}()
+
+	config := &Config{}
+	config.Dashboards = []Dashboard{{Name: "cpu"}, {Name: "billing-cost"}}
+	config.Groups = []Group{
+		{Name: "overview", Dashboards: []string{"cpu", "billing-cost"}},
+		{Name: "system", Dashboards: []string{"cpu"}},
+	}
+	config.Access.Rules = []AccessRule{
+		{Effect: AccessDeny, Aliases: []string{"billing-*"}, Channels: []string{"C-random"}},
+		{Effect: AccessDeny, Aliases: []string{"system"}, Users: []string{"U-guest"}},
+	}
+	Apply(config)
+
+	tests := []struct {
+		name    string
+		subject *Subject
+		want    bool
+	}{
+		{"overview", testSubject("C-finance", "U-any", nil), true},
+		// A group is denied when one of its aliases is.
+		{"overview", testSubject("C-random", "U-any", nil), false},
+		{"system", testSubject("C-random", "U-any", nil), true},
+		// An alias of a denied group may still be rendered by itself.
+		{"system", testSubject("C-random", "U-guest", nil), false},
+		{"cpu", testSubject("C-random", "U-guest", nil), true},
+	}
+	for _, tt := range tests {
+		if got := Allowed(tt.name, tt.subject); got != tt.want {
+			t.Errorf("Allowed(%q, %s in %s) = %t, want %t", tt.name, tt.subject.User, tt.subject.Channel, got, tt.want)
+		}
+	}
+}
+
+func TestAccessValidate(t *testing.T) {
+	tests := []struct {
+		access Access
+		err    string
+	}{
+		{Access{Default: AccessDeny}, ""},
+		{Access{Default: "block"}, `default: must be allow or deny, got "block"`},
+		{Access{Rules: []AccessRule{{Effect: AccessAllow}, {Effect: "permit"}}}, `rules[1].effect: must be allow or deny, got "permit"`},
+		{Access{Rules: []AccessRule{{Effect: AccessAllow, Aliases: []string{"cpu", "billing-["}}}}, `rules[0].aliases[1]: invalid pattern "billing-["`},
+	}
+	for _, tt := range tests {
+		err := tt.access.validate()
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("validate(%+v): %v", tt.access, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("validate(%+v) = %v, want %s", tt.access, err, tt.err)
+		}
+	}
+}
@@ -1,62 +1,785 @@
 package config
 
 import (
+	"bytes"
 	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
 	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/retry"
 )
 
-var Global *Config
+var global atomic.Pointer[Config]
+
+// Current returns the config in use. A reload replaces it, so callers should not keep it.
+func Current() *Config {
+	return global.Load()
+}
 
 func init() {
 	graph = make(map[string]Dashboard, 0)
+	group = make(map[string]Group, 0)
+	discovered = make(map[string]struct{}, 0)
 }
 
 type Config struct {
 	Slack struct {
-		Token  string `yaml:"token"`
-		Secret string `yaml:"secret"`
-		Addr   string `yaml:"addr"`
+		Token           string   `yaml:"token"`
+		TokenFile       string   `yaml:"token_file"`
+		Secret          string   `yaml:"secret"`
+		SecretFile      string   `yaml:"secret_file"`
+		Addr            string   `yaml:"addr"`
+		UseUserTimezone bool     `yaml:"use_user_timezone"`
+		PublicURL       string   `yaml:"public_url"`
+		ImageTTL        Duration `yaml:"image_ttl"`
+		ImageMaxEntries int      `yaml:"image_max_entries"`
+		ImageMaxSizeMB  int      `yaml:"image_max_size_mb"`
+		UploadTimeout   Duration `yaml:"upload_timeout"`
+		GracePeriod     Duration `yaml:"grace_period"`
 	} `yaml:"slack"`
 	Grafana struct {
-		UseClientAuth bool   `yaml:"use_client_auth"`
-		ClientAuthP12 string `yaml:"client_auth_p12"`
-		Endpoint      string `yaml:"endpoint"`
+		Backend        `yaml:",inline"`
+		TLS            TLS      `yaml:"tls"`
+		ConnectTimeout Duration `yaml:"connect_timeout"`
+		RenderTimeout  Duration `yaml:"render_timeout"`
+		RendererURL    string   `yaml:"renderer_url"`
+		Render         `yaml:",inline"`
+		Backends       []NamedBackend `yaml:"backends"`
 	} `yaml:"grafana"`
+	Queue      Queue       `yaml:"queue"`
+	Cache      Cache       `yaml:"cache"`
+	Retry      Retries     `yaml:"retry"`
+	Health     Health      `yaml:"health"`
+	Log        Log         `yaml:"log"`
+	Access     Access      `yaml:"access"`
+	Discovery  Discovery   `yaml:"discovery"`
 	Dashboards []Dashboard `yaml:"dashboards"`
+	Groups     []Group     `yaml:"groups"`
+}
+
+// Backend is a Grafana server and how to authenticate to it: with an API key, a bearer
+// token or a user and password, and optionally a client certificate for an auth proxy.
+type Backend struct {
+	Endpoint               string `yaml:"endpoint"`
+	APIKey                 string `yaml:"api_key"`
+	APIKeyFile             string `yaml:"api_key_file"`
+	Token                  string `yaml:"token"`
+	TokenFile              string `yaml:"token_file"`
+	Username               string `yaml:"username"`
+	Password               string `yaml:"password"`
+	PasswordFile           string `yaml:"password_file"`
+	UseClientAuth          bool   `yaml:"use_client_auth"`
+	ClientAuthP12          string `yaml:"client_auth_p12"`
+	ClientAuthPassword     string `yaml:"client_auth_password"`
+	ClientAuthPasswordFile string `yaml:"client_auth_password_file"`
+}
+
+// NamedBackend is a Grafana server besides the default one, which aliases refer to by name.
+type NamedBackend struct {
+	Name    string `yaml:"name"`
+	Backend `yaml:",inline"`
+	TLS     TLS `yaml:"tls"`
+}
+
+// TLS sets how the certificate of a Grafana server is verified.
+type TLS struct {
+	CAFile             string `yaml:"ca_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// BearerToken returns the API key or the token, which are both sent as a bearer token.
+func (b *Backend) BearerToken() string {
+	if b.APIKey != "" {
+		return b.APIKey
+	}
+	return b.Token
+}
+
+func (b *Backend) validate() error {
+	if b.Endpoint == "" {
+		return invalid("endpoint", errors.New("is required"))
+	}
+	if err := validateURL(b.Endpoint); err != nil {
+		return invalid("endpoint", err)
+	}
+	hasAPIKey := b.APIKey != "" || b.APIKeyFile != ""
+	hasToken := b.Token != "" || b.TokenFile != ""
+	hasPassword := b.Password != "" || b.PasswordFile != ""
+	set := 0
+	for _, v := range []bool{hasAPIKey, hasToken, b.Username != ""} {
+		if v {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of api_key, token and username can be set")
+	}
+	if b.Username != "" && !hasPassword {
+		return invalid("password", errors.New("is required with username, or password_file"))
+	}
+	if hasPassword && b.Username == "" {
+		return invalid("username", errors.New("is required with password"))
+	}
+	if b.UseClientAuth && b.ClientAuthP12 == "" {
+		return invalid("client_auth_p12", errors.New("is required with use_client_auth"))
+	}
+	return nil
+}
+
+// Backends returns every Grafana backend, starting with the default one named "".
+func (c *Config) Backends() []NamedBackend {
+	return append([]NamedBackend{{Backend: c.Grafana.Backend, TLS: c.Grafana.TLS}}, c.Grafana.Backends...)
+}
+
+// Backend returns the Grafana backend of the given name, the default one when empty.
+func (c *Config) Backend(name string) (NamedBackend, bool) {
+	for _, b := range c.Backends() {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return NamedBackend{}, false
+}
+
+// Queue bounds how many renders run at once and how many may wait.
+type Queue struct {
+	Workers   int `yaml:"workers"`
+	MaxLength int `yaml:"max_length"`
+}
+
+// Cache keeps rendered images for identical requests. It is disabled without a backend.
+type Cache struct {
+	Backend    string   `yaml:"backend"`
+	Dir        string   `yaml:"dir"`
+	TTL        Duration `yaml:"ttl"`
+	Step       Duration `yaml:"step"`
+	MaxEntries int      `yaml:"max_entries"`
+	MaxSizeMB  int      `yaml:"max_size_mb"`
+}
+
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendDisk   = "disk"
+)
+
+func (c *Cache) validate() error {
+	switch c.Backend {
+	case "", CacheBackendMemory:
+	case CacheBackendDisk:
+		if c.Dir == "" {
+			return invalid("dir", errors.New("is required for the disk backend"))
+		}
+	default:
+		return invalid("backend", errors.Errorf("unknown backend %q", c.Backend))
+	}
+	return nil
+}
+
+// Log sets the lowest level logged, debug, info, warn or error, and the format, json or logfmt.
+type Log struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+func (l *Log) validate() error {
+	if _, err := logging.ParseLevel(l.Level); err != nil {
+		return invalid("level", err)
+	}
+	switch l.Format {
+	case "", logging.FormatJSON, logging.FormatLogfmt:
+		return nil
+	}
+	return invalid("format", errors.Errorf("unknown format %q", l.Format))
+}
+
+// Health sets how /readyz checks the dependencies.
+type Health struct {
+	CacheTTL Duration `yaml:"cache_ttl"`
+}
+
+type Retries struct {
+	Grafana Retry `yaml:"grafana"`
+	Slack   Retry `yaml:"slack"`
+}
+
+// Retry sets how often a failing call is tried and how long to wait between attempts.
+type Retry struct {
+	Attempts int      `yaml:"attempts"`
+	Initial  Duration `yaml:"initial_backoff"`
+	Max      Duration `yaml:"max_backoff"`
+}
+
+func (r *Retry) setDefaults() {
+	if r.Attempts <= 0 {
+		r.Attempts = DefaultRetryAttempts
+	}
+	if r.Initial <= 0 {
+		r.Initial = Duration(DefaultRetryInitial)
+	}
+	if r.Max <= 0 {
+		r.Max = Duration(DefaultRetryMax)
+	}
+	if r.Max < r.Initial {
+		r.Max = r.Initial
+	}
+}
+
+func (r Retry) Policy() retry.Policy {
+	return retry.Policy{Attempts: r.Attempts, Initial: r.Initial.Duration(), Max: r.Max.Duration()}
+}
+
+// Discovery registers aliases for the panels of Grafana dashboards selected by tags.
+type Discovery struct {
+	Enabled           bool     `yaml:"enabled"`
+	Tags              []string `yaml:"tags"`
+	OrgID             string   `yaml:"orgId"`
+	Prefix            string   `yaml:"prefix"`
+	IncludeDashboards bool     `yaml:"include_dashboards"`
+	Grafana           string   `yaml:"grafana"`
+	Interval          Duration `yaml:"interval"`
+}
+
+const (
+	DefaultDiscoveryInterval = 5 * time.Minute
+	DefaultImageTTL          = 24 * time.Hour
+	DefaultImageMaxEntries   = 1000
+	DefaultImageMaxSizeMB    = 200
+	DefaultUploadTimeout     = 30 * time.Second
+	DefaultGracePeriod       = 30 * time.Second
+	DefaultHealthCacheTTL    = 10 * time.Second
+	DefaultConnectTimeout    = 5 * time.Second
+	DefaultRenderTimeout     = 60 * time.Second
+	DefaultQueueWorkers      = 4
+	DefaultQueueMaxLength    = 100
+	DefaultCacheTTL          = time.Minute
+	DefaultCacheStep         = time.Minute
+	DefaultCacheMaxEntries   = 100
+	DefaultCacheMaxSizeMB    = 100
+	DefaultRetryAttempts     = 3
+	DefaultRetryInitial      = time.Second
+	DefaultRetryMax          = 30 * time.Second
+)
+
+// Duration is a time.Duration written as a string like `5m` or `30s`.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(b []byte) error {
+	v, err := time.ParseDuration(strings.TrimSpace(string(b)))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
 }
 
 type Dashboard struct {
-	Name          string `yaml:"name"`
-	DashboardID   string `yaml:"dashboardId"`
-	DashboardName string `yaml:"dashboardName"`
-	OrgID         string `yaml:"orgId"`
-	PanelID       string `yaml:"panelId"`
+	Name          string            `yaml:"name"`
+	Type          string            `yaml:"type"`
+	DashboardID   string            `yaml:"dashboardId"`
+	DashboardName string            `yaml:"dashboardName"`
+	Title         string            `yaml:"title"`
+	OrgID         string            `yaml:"orgId"`
+	PanelID       string            `yaml:"panelId"`
+	Vars          map[string]Values `yaml:"vars"`
+	Grafana       string            `yaml:"grafana"`
+	Kiosk         string            `yaml:"kiosk"`
+	Scroll        bool              `yaml:"scroll"`
+	Render        `yaml:",inline"`
+}
+
+// ReservedNames are the subcommands of the slash command, which aliases and groups cannot be named.
+var ReservedNames = []string{"list", "search", "help"}
+
+// IsReserved reports whether name is one of ReservedNames.
+func IsReserved(name string) bool {
+	for _, v := range ReservedNames {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Group is an alias for several dashboards rendered together.
+type Group struct {
+	Name       string   `yaml:"name"`
+	Dashboards []string `yaml:"dashboards"`
+	Layout     string   `yaml:"layout"`
+	Columns    int      `yaml:"columns"`
+}
+
+const (
+	GroupLayoutFiles = "files"
+	GroupLayoutGrid  = "grid"
+)
+
+// IsGrid reports whether the group is stitched into a single image.
+func (g *Group) IsGrid() bool {
+	return g.Layout == GroupLayoutGrid
+}
+
+func (g *Group) validate(dashboards map[string]Dashboard) error {
+	if g.Name == "" {
+		return invalid("name", errors.New("is required"))
+	}
+	if IsReserved(g.Name) {
+		return invalid("name", errors.Errorf("%q is a subcommand", g.Name))
+	}
+	if _, ok := dashboards[g.Name]; ok {
+		return invalid("name", errors.Errorf("%q conflicts with a dashboard alias", g.Name))
+	}
+	if len(g.Dashboards) == 0 {
+		return invalid("dashboards", errors.New("must not be empty"))
+	}
+	for i, name := range g.Dashboards {
+		if _, ok := dashboards[name]; !ok {
+			return invalid("dashboards", invalid(i, errors.Errorf("no dashboard alias %q", name)))
+		}
+	}
+	switch g.Layout {
+	case "", GroupLayoutFiles, GroupLayoutGrid:
+	default:
+		return invalid("layout", errors.Errorf("must be %s or %s: %q", GroupLayoutFiles, GroupLayoutGrid, g.Layout))
+	}
+	if g.Columns < 0 {
+		return invalid("columns", errors.New("must not be negative"))
+	}
+	return nil
+}
+
+const (
+	DashboardTypePanel     = "panel"
+	DashboardTypeDashboard = "dashboard"
+
+	KioskTV   = "tv"
+	KioskFull = "full"
+)
+
+// IsDashboard reports whether the alias renders a whole dashboard instead of a single panel.
+func (d *Dashboard) IsDashboard() bool {
+	return d.Type == DashboardTypeDashboard
+}
+
+func (d *Dashboard) validate() error {
+	if d.Name == "" {
+		return invalid("name", errors.New("is required"))
+	}
+	if IsReserved(d.Name) {
+		return invalid("name", errors.Errorf("%q is a subcommand", d.Name))
+	}
+	switch d.Type {
+	case "", DashboardTypePanel, DashboardTypeDashboard:
+	default:
+		return invalid("type", errors.Errorf("must be %s or %s: %q", DashboardTypePanel, DashboardTypeDashboard, d.Type))
+	}
+	if d.DashboardID == "" {
+		return invalid("dashboardId", errors.New("is required"))
+	}
+	if !d.IsDashboard() {
+		if d.PanelID == "" {
+			return invalid("panelId", errors.New("is required for a panel"))
+		}
+		if err := validateNumber(d.PanelID); err != nil {
+			return invalid("panelId", err)
+		}
+	}
+	if d.OrgID != "" {
+		if err := validateNumber(d.OrgID); err != nil {
+			return invalid("orgId", err)
+		}
+	}
+	switch d.Kiosk {
+	case "", KioskTV, KioskFull:
+	default:
+		return invalid("kiosk", errors.Errorf("must be %s or %s: %q", KioskTV, KioskFull, d.Kiosk))
+	}
+	if err := validateTimezone(d.Timezone); err != nil {
+		return invalid("timezone", err)
+	}
+	return d.Render.Validate()
+}
+
+// Values is a template variable value which can be written as a scalar or a list.
+type Values []string
+
+func (v *Values) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*v = list
+		return nil
+	}
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	*v = Values{s}
+	return nil
+}
+
+// Render holds rendering parameters which can be set globally under `grafana:`,
+// per dashboard, and inline in the slash command.
+type Render struct {
+	Timezone string `yaml:"timezone"`
+	Width    int    `yaml:"width"`
+	Height   int    `yaml:"height"`
+	Theme    string `yaml:"theme"`
+	Scale    int    `yaml:"scale"`
+	Timeout  int    `yaml:"timeout"`
+}
+
+const (
+	MaxRenderSize    = 10000
+	MaxRenderScale   = 4
+	MaxRenderTimeout = 300
+)
+
+// IsRenderKey reports whether key is an inline render parameter accepted by Set.
+func IsRenderKey(key string) bool {
+	switch key {
+	case "width", "height", "theme", "scale", "timeout":
+		return true
+	}
+	return false
+}
+
+func (r *Render) Set(key, value string) error {
+	switch key {
+	case "theme":
+		r.Theme = value
+	case "width", "height", "scale", "timeout":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return invalid(key, errors.Errorf("must be a positive number: %q", value))
+		}
+		switch key {
+		case "width":
+			r.Width = n
+		case "height":
+			r.Height = n
+		case "scale":
+			r.Scale = n
+		case "timeout":
+			r.Timeout = n
+		}
+	default:
+		return errors.Errorf("unknown render parameter %q", key)
+	}
+	return r.Validate()
+}
+
+// Validate checks the render parameters. Zero means unset and is accepted.
+func (r *Render) Validate() error {
+	if r.Width < 0 || r.Width > MaxRenderSize {
+		return invalid("width", errors.Errorf("must be positive and at most %d", MaxRenderSize))
+	}
+	if r.Height < 0 || r.Height > MaxRenderSize {
+		return invalid("height", errors.Errorf("must be positive and at most %d", MaxRenderSize))
+	}
+	if r.Scale < 0 || r.Scale > MaxRenderScale {
+		return invalid("scale", errors.Errorf("must be positive and at most %d", MaxRenderScale))
+	}
+	if r.Timeout < 0 || r.Timeout > MaxRenderTimeout {
+		return invalid("timeout", errors.Errorf("must be positive and at most %d seconds", MaxRenderTimeout))
+	}
+	switch r.Theme {
+	case "", "light", "dark":
+	default:
+		return invalid("theme", errors.Errorf("must be light or dark: %q", r.Theme))
+	}
+	return nil
 }
 
 var graph map[string]Dashboard
+var group map[string]Group
+var discovered map[string]struct{}
 var graphMu sync.RWMutex
 
 func Load(path string) error {
+	config, err := Parse(path)
+	if err != nil {
+		return err
+	}
+	Apply(config)
+	return nil
+}
+
+// Parse reads and validates the config file at path without applying it. Secrets are
+// read from their files and the environment.
+func Parse(path string) (*Config, error) {
+	return parse(path, true)
+}
+
+// Check validates the config file at path like Parse, without reading the secrets: it
+// only checks how they are given, so that it runs without the files and environment of
+// the server.
+func Check(path string) error {
+	_, err := parse(path, false)
+	return err
+}
+
+func parse(path string, resolveSecrets bool) (*Config, error) {
 	buf, err := ioutil.ReadFile(path)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
+	}
+	file, err := parser.ParseBytes(buf, 0)
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	if len(file.Docs) > 0 {
+		if err := checkNode(file.Docs[0].Body, reflect.TypeOf(Config{})); err != nil {
+			return nil, locate(buf, err)
+		}
 	}
 	config := &Config{}
-	if err := yaml.Unmarshal(buf, config); err != nil {
-		return errors.WithStack(err)
+	if err := yaml.NewDecoder(bytes.NewReader(buf), yaml.DisallowUnknownField()).Decode(config); err != nil {
+		return nil, decodeError(err)
+	}
+	if err := config.checkSecrets(); err != nil {
+		return nil, locate(buf, err)
+	}
+	if resolveSecrets {
+		if err := config.resolveSecrets(); err != nil {
+			return nil, locate(buf, err)
+		}
+	}
+	if err := config.validate(); err != nil {
+		return nil, locate(buf, err)
+	}
+	if config.Slack.ImageTTL <= 0 {
+		config.Slack.ImageTTL = Duration(DefaultImageTTL)
+	}
+	if config.Slack.ImageMaxEntries <= 0 {
+		config.Slack.ImageMaxEntries = DefaultImageMaxEntries
+	}
+	if config.Slack.ImageMaxSizeMB <= 0 {
+		config.Slack.ImageMaxSizeMB = DefaultImageMaxSizeMB
+	}
+	if config.Slack.UploadTimeout <= 0 {
+		config.Slack.UploadTimeout = Duration(DefaultUploadTimeout)
+	}
+	if config.Slack.GracePeriod <= 0 {
+		config.Slack.GracePeriod = Duration(DefaultGracePeriod)
+	}
+	if config.Health.CacheTTL <= 0 {
+		config.Health.CacheTTL = Duration(DefaultHealthCacheTTL)
+	}
+	if config.Grafana.ConnectTimeout <= 0 {
+		config.Grafana.ConnectTimeout = Duration(DefaultConnectTimeout)
+	}
+	if config.Grafana.RenderTimeout <= 0 {
+		config.Grafana.RenderTimeout = Duration(DefaultRenderTimeout)
+	}
+	if config.Cache.TTL <= 0 {
+		config.Cache.TTL = Duration(DefaultCacheTTL)
+	}
+	if config.Cache.Step <= 0 {
+		config.Cache.Step = Duration(DefaultCacheStep)
+	}
+	if config.Cache.MaxEntries <= 0 {
+		config.Cache.MaxEntries = DefaultCacheMaxEntries
+	}
+	if config.Cache.MaxSizeMB <= 0 {
+		config.Cache.MaxSizeMB = DefaultCacheMaxSizeMB
+	}
+	config.Retry.Grafana.setDefaults()
+	config.Retry.Slack.setDefaults()
+	if config.Queue.Workers <= 0 {
+		config.Queue.Workers = DefaultQueueWorkers
+	}
+	if config.Queue.MaxLength <= 0 {
+		config.Queue.MaxLength = DefaultQueueMaxLength
+	}
+	if config.Discovery.Interval <= 0 {
+		config.Discovery.Interval = Duration(DefaultDiscoveryInterval)
+	}
+	if config.Discovery.OrgID == "" {
+		config.Discovery.OrgID = "1"
 	}
-	Global = config
+	return config, nil
+}
 
+func (c *Config) validate() error {
+	if c.Slack.Token == "" && c.Slack.TokenFile == "" {
+		return invalid("slack", invalid("token", errors.New("is required, or token_file")))
+	}
+	if c.Slack.Secret == "" && c.Slack.SecretFile == "" {
+		return invalid("slack", invalid("secret", errors.New("is required, or secret_file")))
+	}
+	if c.Slack.PublicURL != "" {
+		if err := validateURL(c.Slack.PublicURL); err != nil {
+			return invalid("slack", invalid("public_url", err))
+		}
+	}
+	if err := c.Grafana.Backend.validate(); err != nil {
+		return invalid("grafana", err)
+	}
+	backends := make(map[string]struct{}, len(c.Grafana.Backends))
+	for i, v := range c.Grafana.Backends {
+		if v.Name == "" {
+			return invalid("grafana", invalid("backends", invalid(i, invalid("name", errors.New("is required")))))
+		}
+		if _, ok := backends[v.Name]; ok {
+			return invalid("grafana", invalid("backends", invalid(i, invalid("name", errors.Errorf("duplicate backend %q", v.Name)))))
+		}
+		backends[v.Name] = struct{}{}
+		if err := v.validate(); err != nil {
+			return invalid("grafana", invalid("backends", invalid(i, err)))
+		}
+	}
+	if c.Grafana.RendererURL != "" {
+		if err := validateURL(c.Grafana.RendererURL); err != nil {
+			return invalid("grafana", invalid("renderer_url", err))
+		}
+	}
+	if err := c.Grafana.Render.Validate(); err != nil {
+		return invalid("grafana", err)
+	}
+	if err := validateTimezone(c.Grafana.Timezone); err != nil {
+		return invalid("grafana", invalid("timezone", err))
+	}
+	dashboards := make(map[string]Dashboard, len(c.Dashboards))
+	for i, v := range c.Dashboards {
+		if err := v.validate(); err != nil {
+			return invalid("dashboards", invalid(i, err))
+		}
+		if _, ok := dashboards[v.Name]; ok {
+			return invalid("dashboards", invalid(i, invalid("name", errors.Errorf("duplicate alias %q", v.Name))))
+		}
+		if _, ok := c.Backend(v.Grafana); !ok {
+			return invalid("dashboards", invalid(i, invalid("grafana", errors.Errorf("no backend %q", v.Grafana))))
+		}
+		dashboards[v.Name] = v
+	}
+	groups := make(map[string]struct{}, len(c.Groups))
+	for i, v := range c.Groups {
+		if err := v.validate(dashboards); err != nil {
+			return invalid("groups", invalid(i, err))
+		}
+		if _, ok := groups[v.Name]; ok {
+			return invalid("groups", invalid(i, invalid("name", errors.Errorf("duplicate group %q", v.Name))))
+		}
+		groups[v.Name] = struct{}{}
+	}
+	if c.Discovery.Enabled && len(c.Discovery.Tags) == 0 {
+		return invalid("discovery", invalid("tags", errors.New("must not be empty, or every panel of Grafana is registered")))
+	}
+	if _, ok := c.Backend(c.Discovery.Grafana); !ok {
+		return invalid("discovery", invalid("grafana", errors.Errorf("no backend %q", c.Discovery.Grafana)))
+	}
+	if c.Discovery.OrgID != "" {
+		if err := validateNumber(c.Discovery.OrgID); err != nil {
+			return invalid("discovery", invalid("orgId", err))
+		}
+	}
+	if err := c.Access.validate(); err != nil {
+		return invalid("access", err)
+	}
+	if err := c.Log.validate(); err != nil {
+		return invalid("log", err)
+	}
+	if err := c.Cache.validate(); err != nil {
+		return invalid("cache", err)
+	}
+	return nil
+}
+
+// Changes lists the aliases a reload added, removed or changed, sorted by name.
+type Changes struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports whether no alias changed.
+func (c *Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// Apply makes config the current one and replaces the aliases and groups with its own
+// at once. Discovered aliases are kept unless config now defines the same names.
+func Apply(config *Config) *Changes {
 	graphMu.Lock()
 	defer graphMu.Unlock()
+
+	changes := &Changes{}
+	if old := global.Load(); old != nil {
+		changes = diff(old, config)
+	}
+
+	dashboards := make(map[string]Dashboard, len(config.Dashboards)+len(discovered))
 	for _, v := range config.Dashboards {
-		graph[v.Name] = v
+		dashboards[v.Name] = v
+	}
+	groups := make(map[string]Group, len(config.Groups))
+	for _, v := range config.Groups {
+		groups[v.Name] = v
 	}
+	for name := range discovered {
+		_, isDashboard := dashboards[name]
+		_, isGroup := groups[name]
+		if isDashboard || isGroup {
+			delete(discovered, name)
+			continue
+		}
+		dashboards[name] = graph[name]
+	}
+	graph, group = dashboards, groups
+	global.Store(config)
+	return changes
+}
 
-	return nil
+// diff compares the aliases and groups written in the config files.
+func diff(from, to *Config) *Changes {
+	before := make(map[string]interface{}, len(from.Dashboards)+len(from.Groups))
+	for _, v := range from.Dashboards {
+		before[v.Name] = v
+	}
+	for _, v := range from.Groups {
+		before[v.Name] = v
+	}
+	after := make(map[string]interface{}, len(to.Dashboards)+len(to.Groups))
+	for _, v := range to.Dashboards {
+		after[v.Name] = v
+	}
+	for _, v := range to.Groups {
+		after[v.Name] = v
+	}
+
+	changes := &Changes{}
+	for name, v := range after {
+		w, ok := before[name]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, name)
+		case !reflect.DeepEqual(v, w):
+			changes.Changed = append(changes.Changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changes.Removed = append(changes.Removed, name)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+	return changes
 }
 
 func GetDashboard(name string) (*Dashboard, error) {
@@ -68,3 +791,34 @@ func GetDashboard(name string) (*Dashboard, error) {
 	}
 	return &v, nil
 }
+
+func GetGroup(name string) (*Group, error) {
+	graphMu.RLock()
+	defer graphMu.RUnlock()
+	v, ok := group[name]
+	if !ok {
+		return nil, errors.New("no group")
+	}
+	return &v, nil
+}
+
+// SetDiscovered replaces the aliases registered by discovery. Aliases written in the
+// config file take precedence over discovered ones with the same name.
+func SetDiscovered(dashboards []Dashboard) {
+	graphMu.Lock()
+	defer graphMu.Unlock()
+	for name := range discovered {
+		delete(graph, name)
+	}
+	discovered = make(map[string]struct{}, len(dashboards))
+	for _, v := range dashboards {
+		if _, ok := graph[v.Name]; ok {
+			continue
+		}
+		if _, ok := group[v.Name]; ok {
+			continue
+		}
+		graph[v.Name] = v
+		discovered[v.Name] = struct{}{}
+	}
+}
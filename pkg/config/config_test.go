@@ -0,0 +1,196 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+const testConfig = `slack:
+  token: xoxb-test
+  secret: s3cr3t
+grafana:
+  endpoint: http://grafana:3000/
+  timezone: Asia/Tokyo
+  render_timeout: 90s
+dashboards:
+  - name: cpu
+    dashboardId: abc
+    panelId: "2"
+    width: 800
+    vars:
+      host: [web01, web02]
+      env: prod
+`
+
+func parseString(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return Parse(path)
+}
+
+func TestParse(t *testing.T) {
+	config, err := parseString(t, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Grafana.RenderTimeout.Duration(); got != 90*time.Second {
+		t.Errorf("render_timeout = %s, want 90s", got)
+	}
+	if got := config.Slack.UploadTimeout.Duration(); got != DefaultUploadTimeout {
+		t.Errorf("upload_timeout = %s, want the default %s", got, DefaultUploadTimeout)
+	}
+	if got := config.Queue.Workers; got != DefaultQueueWorkers {
+		t.Errorf("queue.workers = %d, want the default %d", got, DefaultQueueWorkers)
+	}
+	d := config.Dashboards[0]
+	if d.Width != 800 || d.PanelID != "2" {
+		t.Errorf("dashboard = %+v, want width 800 and panelId 2", d)
+	}
+	if got := d.Vars["env"]; len(got) != 1 || got[0] != "prod" {
+		t.Errorf("vars.env = %q, want [prod]", got)
+	}
+	if got := d.Vars["host"]; len(got) != 2 {
+		t.Errorf("vars.host = %q, want [web01 web02]", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace [2]string
+		err     string
+	}{
+		{
+			"bad duration",
+			[2]string{"render_timeout: 90s", "render_timeout: 5x"},
+			`[7:19] grafana.render_timeout: must be a duration like 30s or 5m: "5x"`,
+		},
+		{
+			"duration without unit",
+			[2]string{"  secret: s3cr3t\n", "  secret: s3cr3t\n  upload_timeout: 30\n"},
+			`[4:19] slack.upload_timeout: must be a duration like 30s or 5m: "30"`,
+		},
+		{
+			"type error",
+			[2]string{"dashboards:", "queue:\n  workers: abc\ndashboards:"},
+			`[9:12] queue.workers: must be a number: "abc"`,
+		},
+		{
+			"type error in an inline field",
+			[2]string{"width: 800", "width: abc"},
+			`[12:12] dashboards[0].width: must be a number: "abc"`,
+		},
+		{
+			"type error in a global inline field",
+			[2]string{"render_timeout: 90s", "height: 5x"},
+			`[7:11] grafana.height: must be a number: "5x"`,
+		},
+		{
+			"bool",
+			[2]string{"  secret: s3cr3t\n", "  secret: s3cr3t\n  use_user_timezone: yes please\n"},
+			`[4:22] slack.use_user_timezone: must be true or false: "yes please"`,
+		},
+		{
+			"list",
+			[2]string{"host: [web01, web02]", "host: {name: web01}"},
+			`[14:13] dashboards[0].vars.host: must be a string`,
+		},
+		{
+			"unknown field",
+			[2]string{"render_timeout: 90s", "render_timeout: 90s\n  tls:\n    ca: /ca.pem"},
+			`[9:9] grafana.tls.ca: unknown field`,
+		},
+		{
+			"unknown field in an inline field",
+			[2]string{"width: 800", "witdh: 800"},
+			`[12:12] dashboards[0].witdh: unknown field`,
+		},
+		{
+			"unknown global timezone",
+			[2]string{"Asia/Tokyo", "Mars/Olympus"},
+			`[6:13] grafana.timezone: unknown timezone "Mars/Olympus"`,
+		},
+		{
+			"unknown dashboard timezone",
+			[2]string{"width: 800", "timezone: Mars/Olympus"},
+			`[12:15] dashboards[0].timezone: unknown timezone "Mars/Olympus"`,
+		},
+		{
+			"missing key",
+			[2]string{"    panelId: \"2\"\n", ""},
+			`[9:9] dashboards[0].panelId: is required for a panel`,
+		},
+		{
+			"negative width",
+			[2]string{"width: 800", "width: -5"},
+			`[12:12] dashboards[0].width: must be positive and at most 10000`,
+		},
+		{
+			"global render timeout",
+			[2]string{"render_timeout: 90s", "timeout: 600"},
+			`[7:12] grafana.timeout: must be positive and at most 300 seconds`,
+		},
+		{
+			"subcommand name",
+			[2]string{"name: cpu", "name: help"},
+			`[9:11] dashboards[0].name: "help" is a subcommand`,
+		},
+		{
+			"invalid value",
+			[2]string{"panelId: \"2\"", "panelId: two"},
+			`[11:14] dashboards[0].panelId: must be a number: "two"`,
+		},
+	}
+	for _, tt := range tests {
+		content := strings.Replace(testConfig, tt.replace[0], tt.replace[1], 1)
+		if content == testConfig {
+			t.Fatalf("%s: %q is not in the test config", tt.name, tt.replace[0])
+		}
+		_, err := parseString(t, content)
+		if err == nil {
+			t.Errorf("%s: Parse succeeded, want %s", tt.name, tt.err)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("%s: Parse error\n%s\nwant\n%s", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRenderSet(t *testing.T) {
+	var r Render
+	if err := r.Set("width", "1200"); err != nil || r.Width != 1200 {
+		t.Errorf("Set(width, 1200) = %v, width %d", err, r.Width)
+	}
+	for _, tt := range [][3]string{
+		{"width", "0", `width: must be a positive number: "0"`},
+		{"scale", "5", "scale: must be positive and at most 4"},
+		{"theme", "blue", `theme: must be light or dark: "blue"`},
+	} {
+		r := Render{}
+		if err := r.Set(tt[0], tt[1]); err == nil || err.Error() != tt[2] {
+			t.Errorf("Set(%s, %s) = %v, want %s", tt[0], tt[1], err, tt[2])
+		}
+	}
+}
+
+func TestParseSyntaxError(t *testing.T) {
+	_, err := parseString(t, "slack:\n  token: [xoxb\n")
+	if err == nil || !strings.HasPrefix(err.Error(), "[") || strings.Contains(err.Error(), "\n") {
+		t.Errorf("Parse error = %v, want one line with the position", err)
+	}
+}
+
+func TestParseMissingFile(t *testing.T) {
+	if _, err := Parse(filepath.Join(os.TempDir(), "no-such-config.yaml")); err == nil {
+		t.Error("Parse succeeded on a missing file")
+	}
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// List returns every dashboard alias sorted by name.
+func List() []Dashboard {
+	graphMu.RLock()
+	defer graphMu.RUnlock()
+	list := make([]Dashboard, 0, len(graph))
+	for _, v := range graph {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ListGroups returns every group sorted by name.
+func ListGroups() []Group {
+	graphMu.RLock()
+	defer graphMu.RUnlock()
+	list := make([]Group, 0, len(group))
+	for _, v := range group {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Search fuzzily matches query against alias names, dashboard names and panel titles,
+// best matches first.
+func Search(query string) []Dashboard {
+	query = strings.ToLower(query)
+	type scored struct {
+		dashboard Dashboard
+		score     int
+	}
+	var results []scored
+	for _, v := range List() {
+		best := 0
+		for _, field := range []string{v.Name, v.DashboardName, v.Title} {
+			if score := matchScore(query, strings.ToLower(field)); score > best {
+				best = score
+			}
+		}
+		if best > 0 {
+			results = append(results, scored{dashboard: v, score: best})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+	list := make([]Dashboard, len(results))
+	for i, v := range results {
+		list[i] = v.dashboard
+	}
+	return list
+}
+
+// Suggest returns up to three alias or group names close to name.
+func Suggest(name string) []string {
+	name = strings.ToLower(name)
+	var names []string
+	for _, v := range List() {
+		names = append(names, v.Name)
+	}
+	for _, v := range ListGroups() {
+		names = append(names, v.Name)
+	}
+
+	type scored struct {
+		name  string
+		score int
+	}
+	var results []scored
+	for _, v := range names {
+		if score := matchScore(name, strings.ToLower(v)); score > 0 {
+			results = append(results, scored{name: v, score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+	var suggestions []string
+	for i := 0; i < len(results) && i < 3; i++ {
+		suggestions = append(suggestions, results[i].name)
+	}
+	return suggestions
+}
+
+// matchScore ranks a substring match over a subsequence match over a near miss. Zero means no match.
+func matchScore(query, s string) int {
+	if query == "" || s == "" {
+		return 0
+	}
+	if i := strings.Index(s, query); i >= 0 {
+		return 300 - i
+	}
+	if gaps, ok := subsequence(query, s); ok {
+		return 200 - gaps
+	}
+	if d := levenshtein(query, s); d <= len(query)/3+1 {
+		return 100 - d
+	}
+	return 0
+}
+
+// subsequence reports whether the characters of query appear in order in s and how many characters were skipped.
+func subsequence(query, s string) (int, bool) {
+	q := []rune(query)
+	i, gaps := 0, 0
+	for _, r := range s {
+		if i == len(q) {
+			break
+		}
+		if r == q[i] {
+			i++
+		} else if i > 0 {
+			gaps++
+		}
+	}
+	return gaps, i == len(q)
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var envRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the `${NAME}` references in s with the environment variables.
+func expandEnv(s string) (string, error) {
+	var missing string
+	s = envRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRefRegex.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	if missing != "" {
+		return "", errors.Errorf("environment variable %s is not set", missing)
+	}
+	return s, nil
+}
+
+// readSecretFile reads a secret, dropping the trailing newline most files end with.
+func readSecretFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// secret is a sensitive field at path which can also be read from a file or, for
+// some, the environment variable it was read from before the config had the field.
+type secret struct {
+	path  []interface{}
+	key   string
+	value *string
+	file  string
+	env   string
+}
+
+func (c *Config) secrets() []secret {
+	secrets := []secret{
+		{[]interface{}{"slack"}, "token", &c.Slack.Token, c.Slack.TokenFile, ""},
+		{[]interface{}{"slack"}, "secret", &c.Slack.Secret, c.Slack.SecretFile, ""},
+	}
+	backend := func(path []interface{}, b *Backend, apiKeyEnv, passwordEnv string) {
+		secrets = append(secrets,
+			secret{path, "api_key", &b.APIKey, b.APIKeyFile, apiKeyEnv},
+			secret{path, "token", &b.Token, b.TokenFile, ""},
+			secret{path, "password", &b.Password, b.PasswordFile, ""},
+			secret{path, "client_auth_password", &b.ClientAuthPassword, b.ClientAuthPasswordFile, passwordEnv},
+		)
+	}
+	// GRAFANA_API_KEY is ignored when the default backend authenticates otherwise.
+	apiKeyEnv := "GRAFANA_API_KEY"
+	if b := c.Grafana.Backend; b.Token != "" || b.TokenFile != "" || b.Username != "" {
+		apiKeyEnv = ""
+	}
+	backend([]interface{}{"grafana"}, &c.Grafana.Backend, apiKeyEnv, "CLIENT_AUTH_PASSWORD")
+	for i := range c.Grafana.Backends {
+		backend([]interface{}{"grafana", "backends", i}, &c.Grafana.Backends[i].Backend, "", "")
+	}
+	return secrets
+}
+
+// checkSecrets checks how the secrets are given without reading them: a value and
+// its `_file` are not both set, and `${NAME}` references are well-formed.
+func (c *Config) checkSecrets() error {
+	for _, s := range c.secrets() {
+		if s.file != "" && *s.value != "" {
+			return invalidAt(s.path, invalid(s.key+"_file", errors.Errorf("cannot be set with %s", s.key)))
+		}
+		if strings.Contains(envRefRegex.ReplaceAllString(*s.value, ""), "${") {
+			return invalidAt(s.path, invalid(s.key, errors.New("has a reference not like ${NAME}")))
+		}
+	}
+	return nil
+}
+
+// resolveSecrets sets each sensitive field from the first source given: its `_file`,
+// then its value with `${NAME}` expanded, then its legacy environment variable.
+func (c *Config) resolveSecrets() error {
+	for _, s := range c.secrets() {
+		switch {
+		case s.file != "":
+			v, err := readSecretFile(s.file)
+			if err != nil {
+				return invalidAt(s.path, invalid(s.key+"_file", err))
+			}
+			if v == "" {
+				return invalidAt(s.path, invalid(s.key+"_file", errors.Errorf("%s is empty", s.file)))
+			}
+			*s.value = v
+		case *s.value != "":
+			v, err := expandEnv(*s.value)
+			if err != nil {
+				return invalidAt(s.path, invalid(s.key, err))
+			}
+			*s.value = v
+		case s.env != "":
+			*s.value = os.Getenv(s.env)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSecretConfig = `slack:
+  token_file: /run/secrets/grasla-test-token
+  secret: ${GRASLA_TEST_SECRET}
+grafana:
+  endpoint: http://grafana:3000/
+`
+
+func TestCheckSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace [2]string
+		err     string
+	}{
+		{"file and variable not resolved", [2]string{"", ""}, ""},
+		{"value and file", [2]string{"  secret: ", "  token: xoxb-test\n  secret: "}, `[2:15] slack.token_file: cannot be set with token`},
+		{"bad reference", [2]string{"${GRASLA_TEST_SECRET}", "${GRASLA TEST}"}, `[3:11] slack.secret: has a reference not like ${NAME}`},
+		{"unterminated reference", [2]string{"${GRASLA_TEST_SECRET}", "${GRASLA_TEST"}, `[3:11] slack.secret: has a reference not like ${NAME}`},
+		{"missing", [2]string{"  token_file: /run/secrets/grasla-test-token\n", ""}, `[2:9] slack.token: is required, or token_file`},
+	}
+	for _, tt := range tests {
+		content := strings.Replace(testSecretConfig, tt.replace[0], tt.replace[1], 1)
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := Check(path)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: Check: %v", tt.name, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: Check error = %v, want %s", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("xoxb-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Replace(testSecretConfig, "/run/secrets/grasla-test-token", tokenFile, 1)
+
+	os.Unsetenv("GRASLA_TEST_SECRET")
+	if _, err := parseString(t, content); err == nil || !strings.Contains(err.Error(), "environment variable GRASLA_TEST_SECRET is not set") {
+		t.Errorf("Parse error = %v, want an unset variable", err)
+	}
+
+	os.Setenv("GRASLA_TEST_SECRET", "from-env")
+	defer os.Unsetenv("GRASLA_TEST_SECRET")
+	config, err := parseString(t, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Slack.Token != "xoxb-from-file" {
+		t.Errorf("token = %q, want the file without its newline", config.Slack.Token)
+	}
+	if config.Slack.Secret != "from-env" {
+		t.Errorf("secret = %q, want the environment variable", config.Slack.Secret)
+	}
+}
@@ -0,0 +1,292 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/pkg/errors"
+)
+
+// fieldError is an invalid value in the config file at path, made of the keys and
+// the sequence indexes leading to it.
+type fieldError struct {
+	path []interface{}
+	err  error
+}
+
+func (e *fieldError) Error() string {
+	return e.key() + ": " + e.err.Error()
+}
+
+// key renders path like `dashboards[2].panelId`.
+func (e *fieldError) key() string {
+	var b strings.Builder
+	for _, k := range e.path {
+		switch k := k.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", k)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, k)
+		}
+	}
+	return b.String()
+}
+
+// invalid puts err under key, a map key or a sequence index.
+func invalid(key interface{}, err error) error {
+	if e, ok := err.(*fieldError); ok {
+		e.path = append([]interface{}{key}, e.path...)
+		return e
+	}
+	return &fieldError{path: []interface{}{key}, err: err}
+}
+
+// invalidAt puts err under the keys and indexes of path.
+func invalidAt(path []interface{}, err error) error {
+	for i := len(path) - 1; i >= 0; i-- {
+		err = invalid(path[i], err)
+	}
+	return err
+}
+
+// locate prefixes a validation error with its line and column in buf, like the errors
+// of the YAML decoder. A missing key is located at its parent.
+func locate(buf []byte, err error) error {
+	e, ok := err.(*fieldError)
+	if !ok {
+		return err
+	}
+	file, perr := parser.ParseBytes(buf, 0)
+	if perr != nil || len(file.Docs) == 0 {
+		return err
+	}
+	node := file.Docs[0].Body
+	tk := node.GetToken()
+	for _, k := range e.path {
+		if node = child(node, k); node == nil {
+			break
+		}
+		if t := node.GetToken(); t != nil {
+			tk = t
+		}
+	}
+	if tk == nil {
+		return err
+	}
+	return errors.Errorf("[%d:%d] %s", tk.Position.Line, tk.Position.Column, e.Error())
+}
+
+// decodeError keeps the line with the position of a YAML decoder error, leaving out
+// the source some errors are printed with.
+func decodeError(err error) error {
+	msg := yaml.FormatError(err, false, false)
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	return errors.New(msg)
+}
+
+var (
+	durationType = reflect.TypeOf(Duration(0))
+	valuesType   = reflect.TypeOf(Values(nil))
+)
+
+// checkNode checks that node has the keys and the kinds of values of typ, so that
+// mistakes are reported with their key. The decoder does not check unknown keys and
+// types in inline fields, and reads values like `5x` as 0.
+func checkNode(node ast.Node, typ reflect.Type) error {
+	switch n := node.(type) {
+	case nil, *ast.NullNode, *ast.AliasNode:
+		return nil
+	case *ast.AnchorNode:
+		return checkNode(n.Value, typ)
+	case *ast.TagNode:
+		return checkNode(n.Value, typ)
+	}
+	switch typ {
+	case durationType:
+		s, ok := scalarText(node)
+		if !ok {
+			return errors.New("must be a duration like 30s or 5m")
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			return errors.Errorf("must be a duration like 30s or 5m: %q", s)
+		}
+		return nil
+	case valuesType:
+		if _, ok := node.(*ast.SequenceNode); ok {
+			return checkNode(node, reflect.TypeOf([]string(nil)))
+		}
+		return checkNode(node, typ.Elem())
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map:
+		values, ok := mappingValues(node)
+		if !ok {
+			return errors.New("must be a mapping")
+		}
+		for _, v := range values {
+			if _, ok := v.Key.(*ast.MergeKeyNode); ok {
+				continue
+			}
+			key := keyName(v.Key)
+			elem := typ
+			if typ.Kind() == reflect.Map {
+				elem = typ.Elem()
+			} else if elem, ok = fieldType(typ, key); !ok {
+				return invalid(key, errors.New("unknown field"))
+			}
+			if err := checkNode(v.Value, elem); err != nil {
+				return invalid(key, err)
+			}
+		}
+	case reflect.Slice:
+		seq, ok := node.(*ast.SequenceNode)
+		if !ok {
+			return errors.New("must be a list")
+		}
+		for i, v := range seq.Values {
+			if err := checkNode(v, typ.Elem()); err != nil {
+				return invalid(i, err)
+			}
+		}
+	case reflect.Int:
+		s, _ := scalarText(node)
+		if _, ok := node.(*ast.IntegerNode); !ok {
+			return errors.Errorf("must be a number: %q", s)
+		}
+		if _, err := strconv.ParseInt(s, 0, 64); err != nil {
+			return errors.Errorf("must be a number: %q", s)
+		}
+	case reflect.Bool:
+		if _, ok := node.(*ast.BoolNode); !ok {
+			s, _ := scalarText(node)
+			return errors.Errorf("must be true or false: %q", s)
+		}
+	case reflect.String:
+		if _, ok := scalarText(node); !ok {
+			return errors.New("must be a string")
+		}
+	}
+	return nil
+}
+
+// fieldType returns the type of the field of the struct type typ decoded from key,
+// looking into inline fields.
+func fieldType(typ reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			if t, ok := fieldType(f.Type, key); ok {
+				return t, true
+			}
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if name == key {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
+
+// mappingValues returns the keys and values of a mapping, which is parsed as a single
+// MappingValueNode when it has one key.
+func mappingValues(node ast.Node) ([]*ast.MappingValueNode, bool) {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values, true
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}, true
+	}
+	return nil, false
+}
+
+func keyName(key ast.Node) string {
+	if s, ok := key.(*ast.StringNode); ok {
+		return s.Value
+	}
+	return key.String()
+}
+
+// scalarText returns a scalar as written, which the values of some nodes are not.
+func scalarText(node ast.Node) (string, bool) {
+	switch n := node.(type) {
+	case *ast.StringNode:
+		return n.Value, true
+	case *ast.LiteralNode:
+		return n.Value.Value, true
+	case ast.ScalarNode:
+		return n.GetToken().Value, true
+	}
+	return "", false
+}
+
+func child(node ast.Node, key interface{}) ast.Node {
+	if n, ok := node.(*ast.AnchorNode); ok {
+		node = n.Value
+	}
+	switch n := node.(type) {
+	case *ast.SequenceNode:
+		if i, ok := key.(int); ok && i < len(n.Values) {
+			return n.Values[i]
+		}
+	case *ast.MappingNode:
+		for _, v := range n.Values {
+			if found := child(v, key); found != nil {
+				return found
+			}
+		}
+	case *ast.MappingValueNode:
+		if keyName(n.Key) == fmt.Sprint(key) {
+			return n.Value
+		}
+	}
+	return nil
+}
+
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Errorf("invalid URL %q", rawURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("must be an http or https URL with a host: %q", rawURL)
+	}
+	return nil
+}
+
+func validateTimezone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return errors.Errorf("unknown timezone %q", tz)
+	}
+	return nil
+}
+
+func validateNumber(s string) error {
+	if _, err := strconv.Atoi(s); err != nil {
+		return errors.Errorf("must be a number: %q", s)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+)
+
+// watchInterval is how often the modification time of the config file is checked.
+const watchInterval = 5 * time.Second
+
+// Watch reloads the config file at path when it is modified or on SIGHUP, until ctx is
+// done. A config failing validation is logged and the current one kept, as is one whose
+// aliases use a Grafana backend added since Watch was called, which has no client until
+// a restart. Otherwise it is applied and passed to reload, which updates the settings
+// held outside this package.
+func Watch(ctx context.Context, path string, reload func(*Config)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	modTime := statModTime(path)
+	backends := make(map[string]bool)
+	for _, b := range Current().Backends() {
+		backends[b.Name] = true
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				modTime = statModTime(path)
+				logging.Info(ctx, "reloading config on SIGHUP", "file", path)
+			case <-ticker.C:
+				t := statModTime(path)
+				if t.Equal(modTime) {
+					continue
+				}
+				modTime = t
+				logging.Info(ctx, "reloading modified config", "file", path)
+			}
+			config, err := Parse(path)
+			if err != nil {
+				logging.Error(ctx, "invalid config, keeping the current one", "file", path, "err", err)
+				continue
+			}
+			if err := usesNewBackend(config, backends); err != nil {
+				logging.Error(ctx, "config needs a restart, keeping the current one", "file", path, "err", err)
+				continue
+			}
+			old := Current()
+			changes := Apply(config)
+			if keys := restartRequired(old, config); len(keys) > 0 {
+				logging.Warn(ctx, "config changes need a restart to apply", "keys", keys)
+			}
+			reload(config)
+			logging.Info(ctx, "config reloaded", "added", changes.Added, "removed", changes.Removed, "changed", changes.Changed)
+		}
+	}()
+}
+
+func statModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// usesNewBackend reports an alias or the discovery using a Grafana backend which is
+// not one of backends.
+func usesNewBackend(c *Config, backends map[string]bool) error {
+	for _, d := range c.Dashboards {
+		if !backends[d.Grafana] {
+			return errors.Errorf("alias %s uses the Grafana backend %q added since startup", d.Name, d.Grafana)
+		}
+	}
+	if c.Discovery.Enabled && !backends[c.Discovery.Grafana] {
+		return errors.Errorf("discovery uses the Grafana backend %q added since startup", c.Discovery.Grafana)
+	}
+	return nil
+}
+
+// restartRequired returns the settings which changed but are only read at startup.
+func restartRequired(from, to *Config) []string {
+	var keys []string
+	changed := func(key string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			keys = append(keys, key)
+		}
+	}
+	changed("slack.addr", from.Slack.Addr, to.Slack.Addr)
+	changed("slack.image_ttl", from.Slack.ImageTTL, to.Slack.ImageTTL)
+	changed("slack.image_max_entries", from.Slack.ImageMaxEntries, to.Slack.ImageMaxEntries)
+	changed("slack.image_max_size_mb", from.Slack.ImageMaxSizeMB, to.Slack.ImageMaxSizeMB)
+	changed("grafana.connect_timeout", from.Grafana.ConnectTimeout, to.Grafana.ConnectTimeout)
+	for _, b := range to.Backends() {
+		key := "grafana"
+		if b.Name != "" {
+			key = fmt.Sprintf("grafana.backends[%s]", b.Name)
+		}
+		old, ok := from.Backend(b.Name)
+		if !ok {
+			// The client of a new backend is only built at startup.
+			keys = append(keys, key)
+			continue
+		}
+		changed(key+".tls", old.TLS, b.TLS)
+		changed(key+".use_client_auth", old.UseClientAuth, b.UseClientAuth)
+		changed(key+".client_auth_p12", old.ClientAuthP12, b.ClientAuthP12)
+		changed(key+".client_auth_password", old.ClientAuthPassword, b.ClientAuthPassword)
+	}
+	changed("queue", from.Queue, to.Queue)
+	changed("cache", from.Cache, to.Cache)
+	changed("discovery", from.Discovery, to.Discovery)
+	return keys
+}
@@ -0,0 +1,41 @@
+package grafana
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+)
+
+// Backends has a client per Grafana backend by name, the default one being "", and
+// renders each alias with the client of its backend.
+type Backends map[string]*Client
+
+func (b Backends) client(name string) (*Client, error) {
+	d, err := config.GetDashboard(name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c, ok := b[d.Grafana]
+	if !ok {
+		return nil, errors.Errorf("no Grafana backend %q", d.Grafana)
+	}
+	return c, nil
+}
+
+func (b Backends) Render(ctx context.Context, name string, opts ...Option) (*Graph, error) {
+	c, err := b.client(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Render(ctx, name, opts...)
+}
+
+func (b Backends) DashboardURL(name string, opts ...Option) (string, error) {
+	c, err := b.client(name)
+	if err != nil {
+		return "", err
+	}
+	return c.DashboardURL(name, opts...)
+}
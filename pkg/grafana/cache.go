@@ -0,0 +1,57 @@
+package grafana
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/cache"
+)
+
+type noCacheKey struct{}
+
+// NoCache makes renders with ctx skip cached images. Their result is still cached.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func noCache(ctx context.Context) bool {
+	v, _ := ctx.Value(noCacheKey{}).(bool)
+	return v
+}
+
+// SetCache caches rendered images. Time ranges are rounded down to step, so that
+// `now-1h` requested twice within step renders once.
+func (c *Client) SetCache(cache cache.Cache, step time.Duration) {
+	c.cache = cache
+	c.cacheStep = step
+}
+
+// cacheKey identifies a render by its host and path, so that backends can share a cache,
+// and its parameters with the time range resolved and rounded to the cache step.
+// Parameters not changing the image are left out.
+func (c *Client) cacheKey(renderPath string, params url.Values) string {
+	key := url.Values{}
+	for k, v := range params {
+		key[k] = v
+	}
+	key.Del("timeout")
+
+	loc, err := LoadLocation(params.Get("tz"))
+	if err != nil {
+		loc = time.Local
+	}
+	round := func(t time.Time) string {
+		return strconv.FormatInt(t.Truncate(c.cacheStep).UnixNano()/int64(time.Millisecond), 10)
+	}
+	tr := TimeRange{From: params.Get("from"), To: params.Get("to")}
+	if from, to, err := tr.Resolve(loc); err == nil {
+		key.Set("from", round(from))
+		key.Set("to", round(to))
+	} else {
+		// The dashboard time range applies, which is relative to now.
+		key.Set("now", round(time.Now()))
+	}
+	return renderPath + "?" + key.Encode()
+}
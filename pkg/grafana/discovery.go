@@ -0,0 +1,208 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+)
+
+type SearchResult struct {
+	UID   string   `json:"uid"`
+	Title string   `json:"title"`
+	URL   string   `json:"url"`
+	Type  string   `json:"type"`
+	Tags  []string `json:"tags"`
+}
+
+type DashboardResponse struct {
+	Dashboard struct {
+		UID    string  `json:"uid"`
+		Title  string  `json:"title"`
+		Panels []Panel `json:"panels"`
+	} `json:"dashboard"`
+	Meta struct {
+		Slug string `json:"slug"`
+	} `json:"meta"`
+}
+
+type Panel struct {
+	ID     int     `json:"id"`
+	Title  string  `json:"title"`
+	Type   string  `json:"type"`
+	Panels []Panel `json:"panels"`
+}
+
+var slugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slugify(s string) string {
+	return strings.Trim(slugRegex.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+func (c *Client) getJSON(ctx context.Context, apiPath string, query url.Values, v interface{}) error {
+	settings := c.snapshot()
+	endpoint, err := settings.endpointURL()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	endpoint.Path = path.Join(endpoint.Path, apiPath)
+	endpoint.RawQuery = query.Encode()
+	var data []byte
+	err = settings.Retry.Do(ctx, retryable, func() error {
+		_, body, err := c.get(ctx, settings, endpoint, settings.RenderTimeout)
+		data = body
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "GET %s", apiPath)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Search lists dashboards having all the given tags.
+func (c *Client) Search(ctx context.Context, tags ...string) ([]SearchResult, error) {
+	query := url.Values{"type": {"dash-db"}}
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	var results []SearchResult
+	if err := c.getJSON(ctx, "/api/search", query, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *Client) GetDashboardByUID(ctx context.Context, uid string) (*DashboardResponse, error) {
+	var d DashboardResponse
+	if err := c.getJSON(ctx, path.Join("/api/dashboards/uid", uid), nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Discover builds aliases for every panel of the dashboards matching the discovery tags.
+// A panel alias is its slugified title, prefixed by the dashboard slug when the title is
+// used on more than one dashboard, and followed by the panel ID when the title is used
+// more than once on the same dashboard. Dashboards which cannot be read are skipped.
+func (c *Client) Discover(ctx context.Context, discovery *config.Discovery) ([]config.Dashboard, error) {
+	results, err := c.Search(ctx, discovery.Tags...)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []config.Dashboard
+	count := make(map[string]int)
+	for _, r := range results {
+		d, err := c.GetDashboardByUID(ctx, r.UID)
+		if err != nil {
+			logging.Warn(ctx, "cannot read a discovered dashboard, skipping it", "uid", r.UID, "title", r.Title, "err", err)
+			continue
+		}
+		base := config.Dashboard{
+			DashboardID:   d.Dashboard.UID,
+			DashboardName: d.Meta.Slug,
+			OrgID:         discovery.OrgID,
+			Grafana:       discovery.Grafana,
+		}
+		if discovery.IncludeDashboards {
+			v := base
+			v.Name = d.Meta.Slug
+			v.Type = config.DashboardTypeDashboard
+			v.Title = d.Dashboard.Title
+			candidates = append(candidates, v)
+			count[v.Name]++
+		}
+		for _, p := range flattenPanels(d.Dashboard.Panels) {
+			v := base
+			v.Name = slugify(p.Title)
+			if v.Name == "" {
+				v.Name = fmt.Sprintf("panel-%d", p.ID)
+			}
+			v.PanelID = strconv.Itoa(p.ID)
+			v.Title = fmt.Sprintf("%s / %s", d.Dashboard.Title, p.Title)
+			candidates = append(candidates, v)
+			count[v.Name]++
+		}
+	}
+
+	prefixed := make(map[string]int)
+	for i, v := range candidates {
+		if count[v.Name] > 1 && !v.IsDashboard() {
+			candidates[i].Name = v.DashboardName + "-" + v.Name
+		}
+		prefixed[candidates[i].Name]++
+	}
+
+	dashboards := make([]config.Dashboard, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, v := range candidates {
+		if prefixed[v.Name] > 1 && !v.IsDashboard() {
+			v.Name += "-" + v.PanelID
+		}
+		v.Name = discovery.Prefix + v.Name
+		if config.IsReserved(v.Name) {
+			logging.Warn(ctx, "discovered alias is a subcommand, dropping it", "name", v.Name, "title", v.Title)
+			continue
+		}
+		if seen[v.Name] {
+			logging.Warn(ctx, "discovered alias is duplicated, dropping it", "name", v.Name, "title", v.Title)
+			continue
+		}
+		seen[v.Name] = true
+		dashboards = append(dashboards, v)
+	}
+	return dashboards, nil
+}
+
+// flattenPanels returns the panels including those inside collapsed rows, without the rows themselves.
+func flattenPanels(panels []Panel) []Panel {
+	var result []Panel
+	for _, p := range panels {
+		if p.Type == "row" {
+			result = append(result, flattenPanels(p.Panels)...)
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// StartDiscovery registers discovered aliases now and then refreshes them periodically
+// until ctx is done. The previous aliases are kept when a refresh fails.
+func (c *Client) StartDiscovery(ctx context.Context, discovery *config.Discovery) {
+	refresh := func() {
+		dashboards, err := c.Discover(ctx, discovery)
+		if err != nil {
+			logging.Error(ctx, "discovery failed, keeping the previous aliases", "err", err)
+			return
+		}
+		config.SetDiscovered(dashboards)
+		logging.Info(ctx, "discovered aliases", "count", len(dashboards))
+	}
+	refresh()
+	go func() {
+		ticker := time.NewTicker(discovery.Interval.Duration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh()
+			}
+		}
+	}()
+}
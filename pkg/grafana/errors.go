@@ -0,0 +1,149 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ErrorKind int
+
+const (
+	ErrStatus ErrorKind = iota
+	ErrUnauthorized
+	ErrNotFound
+	ErrRendererUnavailable
+	ErrTimeout
+	ErrNotImage
+	ErrUnreachable
+	ErrCanceled
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrUnauthorized:
+		return "unauthorized"
+	case ErrNotFound:
+		return "not found"
+	case ErrRendererUnavailable:
+		return "renderer unavailable"
+	case ErrTimeout:
+		return "timeout"
+	case ErrNotImage:
+		return "not an image"
+	case ErrUnreachable:
+		return "unreachable"
+	case ErrCanceled:
+		return "canceled"
+	}
+	return "unexpected status"
+}
+
+// Error is returned by the client when Grafana does not answer with what was asked.
+type Error struct {
+	Kind        ErrorKind
+	StatusCode  int
+	ContentType string
+	Message     string
+	// transient is set when the connection could not be made or was reset, so that the
+	// request may be tried again. TLS and URL errors will not go away by themselves.
+	transient bool
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("grafana: %s: status %d: %s", e.Kind, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("grafana: %s: %s", e.Kind, e.Message)
+}
+
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+// maxErrorBody is how much of an error response is kept in the message.
+const maxErrorBody = 256
+
+// requestError classifies an error of http.Client.Do.
+func requestError(err error) *Error {
+	if stderrors.Is(err, context.Canceled) {
+		return &Error{Kind: ErrCanceled, Message: err.Error()}
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return &Error{Kind: ErrTimeout, Message: err.Error()}
+	}
+	var opErr *net.OpError
+	transient := stderrors.As(err, &opErr) && opErr.Op == "dial" ||
+		stderrors.Is(err, syscall.ECONNREFUSED) || stderrors.Is(err, syscall.ECONNRESET)
+	return &Error{Kind: ErrUnreachable, Message: err.Error(), transient: transient}
+}
+
+// responseError classifies a non-200 response. It reads part of the body.
+func responseError(resp *http.Response) *Error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e := &Error{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Message:     strings.TrimSpace(string(body)),
+	}
+	lower := strings.ToLower(e.Message)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.Kind = ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		e.Kind = ErrNotFound
+	case resp.StatusCode == http.StatusGatewayTimeout:
+		e.Kind = ErrTimeout
+	// The renderer answers 500 with a message when its page does not load in time.
+	case resp.StatusCode >= 500 && (strings.Contains(lower, "timeout") || strings.Contains(lower, "timed out")):
+		e.Kind = ErrTimeout
+	case resp.StatusCode >= 500:
+		e.Kind = ErrRendererUnavailable
+	default:
+		e.Kind = ErrStatus
+	}
+	return e
+}
+
+// retryable reports whether a request may succeed when tried again, like when the
+// renderer is starting and refuses connections. Timeouts are not retried as the render would take as long again.
+func retryable(err error) (bool, time.Duration) {
+	e, ok := errors.Cause(err).(*Error)
+	if !ok {
+		return false, 0
+	}
+	switch {
+	case e.Kind == ErrRendererUnavailable, e.transient:
+		return true, 0
+	case e.StatusCode == http.StatusTooManyRequests:
+		return true, 0
+	}
+	return false, 0
+}
+
+// checkImage ensures a 200 response of the renderer is a PNG. A login page means the
+// request was redirected because it was not authenticated.
+func checkImage(resp *http.Response, data []byte) error {
+	if bytes.HasPrefix(data, pngMagic) {
+		return nil
+	}
+	e := &Error{
+		Kind:        ErrNotImage,
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Message:     fmt.Sprintf("content type %q", resp.Header.Get("Content-Type")),
+	}
+	if resp.Request != nil && strings.HasSuffix(resp.Request.URL.Path, "/login") {
+		e.Kind = ErrUnauthorized
+		e.Message = "redirected to the login page"
+	}
+	return e
+}
@@ -0,0 +1,71 @@
+package grafana
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   ErrorKind
+	}{
+		{http.StatusUnauthorized, "", ErrUnauthorized},
+		{http.StatusNotFound, "", ErrNotFound},
+		{http.StatusGatewayTimeout, "", ErrTimeout},
+		{http.StatusInternalServerError, "Rendering failed: TimeoutError: Navigation timeout of 60000 ms exceeded", ErrTimeout},
+		{http.StatusInternalServerError, "Rendering failed", ErrRendererUnavailable},
+		{http.StatusBadRequest, `invalid "timeout" parameter`, ErrStatus},
+		{http.StatusTooManyRequests, "", ErrStatus},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(tt.body))}
+		if got := responseError(resp).Kind; got != tt.want {
+			t.Errorf("responseError(%d, %q) = %s, want %s", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRetryableRequestError(t *testing.T) {
+	tls := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tls.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	reset := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+	}))
+	defer reset.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want bool
+	}{
+		{"connection refused", closed.URL, true},
+		{"connection reset", reset.URL, true},
+		{"unknown certificate", tls.URL, false},
+		{"unsupported scheme", "gopher://grafana:3000/", false},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = http.DefaultClient.Do(req)
+		if err == nil {
+			t.Errorf("%s: request succeeded", tt.name)
+			continue
+		}
+		e := requestError(err)
+		if got, _ := retryable(e); got != tt.want || e.Kind != ErrUnreachable {
+			t.Errorf("%s: %v is %s, retryable %t, want unreachable and %t", tt.name, err, e.Kind, got, tt.want)
+		}
+	}
+}
@@ -2,19 +2,28 @@ package grafana
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/pkcs12"
 
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/cache"
 	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/retry"
 )
 
 type Graph struct {
@@ -23,20 +32,77 @@ type Graph struct {
 }
 
 type Client struct {
-	endpoint string
-	apiKey   string
-	client   *http.Client
+	client    *http.Client
+	transport *http.Transport
+	cache     cache.Cache
+	cacheStep time.Duration
+
+	// mu guards the settings a config reload may change.
+	mu       sync.RWMutex
+	settings Settings
+}
+
+// Settings are what a config reload may change in a client. Each request reads them
+// once, so that it never mixes the endpoint of one config with the credentials of another.
+type Settings struct {
+	Endpoint string
+	// APIKey is sent as a bearer token. Without it, Username and Password are sent
+	// with basic authentication when set.
+	APIKey   string
+	Username string
+	Password string
+	// RenderTimeout limits a whole request to Grafana. A render is given at least its
+	// `timeout` parameter and a few seconds more.
+	RenderTimeout time.Duration
+	// Retry retries requests failing because Grafana or its renderer is unavailable.
+	Retry retry.Policy
 }
 
 func NewClient(endpoint string) *Client {
-	return &Client{
-		endpoint: endpoint,
-		client:   &http.Client{},
+	c := &Client{
+		settings: Settings{
+			Endpoint:      endpoint,
+			RenderTimeout: config.DefaultRenderTimeout,
+		},
 	}
+	c.transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	c.SetConnectTimeout(config.DefaultConnectTimeout)
+	c.client = &http.Client{Transport: c.transport}
+	return c
+}
+
+// SetConnectTimeout limits establishing the connection and the TLS handshake with Grafana.
+func (c *Client) SetConnectTimeout(timeout time.Duration) {
+	c.transport.DialContext = (&net.Dialer{Timeout: timeout}).DialContext
+	c.transport.TLSHandshakeTimeout = timeout
+}
+
+// Configure replaces every setting a config reload may change at once.
+func (c *Client) Configure(settings Settings) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.settings = settings
 }
 
-func (c *Client) SetAPIKey(apiKey string) {
-	c.apiKey = apiKey
+func (c *Client) snapshot() *Settings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s := c.settings
+	return &s
+}
+
+func (s *Settings) endpointURL() (*url.URL, error) {
+	return url.Parse(s.Endpoint)
+}
+
+func (s *Settings) requestTimeout(params url.Values) time.Duration {
+	timeout := s.RenderTimeout
+	if seconds, err := strconv.Atoi(params.Get("timeout")); err == nil {
+		if t := time.Duration(seconds)*time.Second + 5*time.Second; t > timeout {
+			timeout = t
+		}
+	}
+	return timeout
 }
 
 type DsoloParams struct {
@@ -48,41 +114,134 @@ type DsoloParams struct {
 
 type Request http.Request
 
-func (c *Client) NewRequest(URL *url.URL, method string) *Request {
+// NewRequest makes a request to URL authenticated with the credentials of settings.
+func (c *Client) NewRequest(ctx context.Context, settings *Settings, URL *url.URL, method string) *Request {
 	req := Request{URL: URL, Method: method}
 	req.Header = make(http.Header)
-	if c.apiKey != "" {
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	if settings.APIKey != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", settings.APIKey))
+	} else if settings.Username != "" {
+		(*http.Request)(&req).SetBasicAuth(settings.Username, settings.Password)
 	}
-	return &req
+	return (*Request)((*http.Request)(&req).WithContext(ctx))
 }
 
 type Option func(*url.Values) *url.Values
 
 func PanelId(panelId string) Option {
 	return func(v *url.Values) *url.Values {
-		v.Add("panelId", panelId)
+		v.Set("panelId", panelId)
 		return v
 	}
 }
 
 func From(from string) Option {
 	return func(v *url.Values) *url.Values {
-		v.Add("from", from)
+		v.Set("from", from)
 		return v
 	}
 }
 
 func To(to string) Option {
 	return func(v *url.Values) *url.Values {
-		v.Add("to", to)
+		v.Set("to", to)
+		return v
+	}
+}
+
+func Timezone(tz string) Option {
+	return func(v *url.Values) *url.Values {
+		v.Set("tz", tz)
+		return v
+	}
+}
+
+func Width(width int) Option {
+	return func(v *url.Values) *url.Values {
+		v.Set("width", strconv.Itoa(width))
+		return v
+	}
+}
+
+func Height(height int) Option {
+	return func(v *url.Values) *url.Values {
+		v.Set("height", strconv.Itoa(height))
+		return v
+	}
+}
+
+func Theme(theme string) Option {
+	return func(v *url.Values) *url.Values {
+		v.Set("theme", theme)
+		return v
+	}
+}
+
+func Scale(scale int) Option {
+	return func(v *url.Values) *url.Values {
+		v.Set("scale", strconv.Itoa(scale))
+		return v
+	}
+}
+
+func Timeout(seconds int) Option {
+	return func(v *url.Values) *url.Values {
+		v.Set("timeout", strconv.Itoa(seconds))
 		return v
 	}
 }
 
+// Var sets the template variable name. Multiple values select several options, and `$__all` selects all.
+func Var(name string, values ...string) Option {
+	return func(v *url.Values) *url.Values {
+		key := "var-" + strings.TrimPrefix(name, "var-")
+		v.Del(key)
+		for _, value := range values {
+			v.Add(key, value)
+		}
+		return v
+	}
+}
+
+// Kiosk sets the kiosk mode of a dashboard render: `tv` or `full`.
+func Kiosk(mode string) Option {
+	return func(v *url.Values) *url.Values {
+		if mode == config.KioskTV {
+			v.Set("kiosk", "tv")
+		} else {
+			v.Set("kiosk", "1")
+		}
+		return v
+	}
+}
+
+// RenderOptions converts the non-zero fields of r into options.
+func RenderOptions(r *config.Render) []Option {
+	var o []Option
+	if r.Timezone != "" {
+		o = append(o, Timezone(r.Timezone))
+	}
+	if r.Width != 0 {
+		o = append(o, Width(r.Width))
+	}
+	if r.Height != 0 {
+		o = append(o, Height(r.Height))
+	}
+	if r.Theme != "" {
+		o = append(o, Theme(r.Theme))
+	}
+	if r.Scale != 0 {
+		o = append(o, Scale(r.Scale))
+	}
+	if r.Timeout != 0 {
+		o = append(o, Timeout(r.Timeout))
+	}
+	return o
+}
+
 func OrgId(orgid string) Option {
 	return func(v *url.Values) *url.Values {
-		v.Add("orgId", orgid)
+		v.Set("orgId", orgid)
 		return v
 	}
 }
@@ -107,52 +266,193 @@ func (c *Client) LoadP12(keyPath, password string) error {
 		return errors.WithStack(err)
 	}
 
-	caCertPool, _ := x509.SystemCertPool()
-	caCertPool.AppendCertsFromPEM(b[1].Bytes)
-
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      caCertPool,
-	}
+	tlsConfig := c.tlsConfig()
+	tlsConfig.RootCAs.AppendCertsFromPEM(b[1].Bytes)
+	tlsConfig.Certificates = []tls.Certificate{cert}
 	tlsConfig.BuildNameToCertificate()
-	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	return nil
+}
 
-	c.client.Transport = transport
+// SetTLS verifies the certificate of Grafana with the CAs in caFile besides the system
+// ones, for serverName when it is not the host of the endpoint. insecure skips it.
+func (c *Client) SetTLS(caFile, serverName string, insecure bool) error {
+	tlsConfig := c.tlsConfig()
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return errors.Errorf("no certificate found in %s", caFile)
+		}
+	}
+	tlsConfig.ServerName = serverName
+	tlsConfig.InsecureSkipVerify = insecure
 	return nil
 }
 
-func (c *Client) GetDsolo(name string, opts ...Option) (*Graph, error) {
+func (c *Client) tlsConfig() *tls.Config {
+	if c.transport.TLSClientConfig == nil {
+		caCertPool, err := x509.SystemCertPool()
+		if err != nil {
+			caCertPool = x509.NewCertPool()
+		}
+		c.transport.TLSClientConfig = &tls.Config{RootCAs: caCertPool}
+	}
+	return c.transport.TLSClientConfig
+}
+
+// Render renders the alias as a single panel or as a whole dashboard depending on its type.
+func (c *Client) Render(ctx context.Context, name string, opts ...Option) (*Graph, error) {
+	d, err := config.GetDashboard(name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if d.IsDashboard() {
+		return c.GetD(ctx, name, opts...)
+	}
+	return c.GetDsolo(ctx, name, opts...)
+}
+
+func (c *Client) GetDsolo(ctx context.Context, name string, opts ...Option) (*Graph, error) {
 	d, err := config.GetDashboard(name)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	o := []Option{OrgId(d.OrgID), PanelId(d.PanelID)}
+	o := append([]Option{OrgId(d.OrgID), PanelId(d.PanelID)}, dashboardOptions(d)...)
 	for _, v := range opts {
 		o = append(o, v)
 	}
-	return c.getDsolo(d.DashboardID, d.DashboardName, o...)
+	return c.render(ctx, "/render/d-solo/", d.DashboardID, d.DashboardName, o...)
 }
 
-func (c *Client) getDsolo(dashboardId, dashboardName string, option ...Option) (*Graph, error) {
-	endpoint, err := url.Parse(c.endpoint)
+func (c *Client) GetD(ctx context.Context, name string, opts ...Option) (*Graph, error) {
+	d, err := config.GetDashboard(name)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	endpoint.Path = path.Join("/render/d-solo/", dashboardId, "/", dashboardName)
-	req := c.NewRequest(endpoint, http.MethodGet)
-	params := req.URL.Query()
-	for _, v := range option {
+	o := append([]Option{OrgId(d.OrgID)}, dashboardOptions(d)...)
+	if d.Kiosk != "" {
+		o = append(o, Kiosk(d.Kiosk))
+	}
+	if d.Scroll {
+		o = append(o, Height(-1))
+	}
+	for _, v := range opts {
+		o = append(o, v)
+	}
+	return c.render(ctx, "/render/d/", d.DashboardID, d.DashboardName, o...)
+}
+
+// DashboardURL returns the Grafana page of the alias with the given time range and variables.
+func (c *Client) DashboardURL(name string, opts ...Option) (string, error) {
+	d, err := config.GetDashboard(name)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	endpoint, err := c.snapshot().endpointURL()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	endpoint.Path = path.Join("/d/", d.DashboardID, "/", d.DashboardName)
+	params := url.Values{}
+	o := append([]Option{OrgId(d.OrgID)}, dashboardOptions(d)...)
+	for _, v := range append(o, opts...) {
 		v(&params)
 	}
-	req.URL.RawQuery = params.Encode()
+	for _, key := range []string{"width", "height", "scale", "timeout", "kiosk"} {
+		params.Del(key)
+	}
+	if !d.IsDashboard() {
+		params.Set("viewPanel", d.PanelID)
+	}
+	endpoint.RawQuery = params.Encode()
+	return endpoint.String(), nil
+}
+
+func dashboardOptions(d *config.Dashboard) []Option {
+	var o []Option
+	o = append(o, RenderOptions(&config.Current().Grafana.Render)...)
+	o = append(o, RenderOptions(&d.Render)...)
+	for name, values := range d.Vars {
+		o = append(o, Var(name, values...))
+	}
+	return o
+}
+
+// get makes one GET request with settings and reads the whole response. Statuses other
+// than 200 are errors.
+func (c *Client) get(ctx context.Context, settings *Settings, endpoint *url.URL, timeout time.Duration) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req := c.NewRequest(ctx, settings, endpoint, http.MethodGet)
 	resp, err := c.client.Do((*http.Request)(req))
 	if err != nil {
-		return nil, errors.WithStack(err)
+		grafanaResponses.Inc("error")
+		return nil, nil, errors.WithStack(requestError(err))
+	}
+	defer resp.Body.Close()
+	grafanaResponses.Inc(strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errors.WithStack(responseError(resp))
 	}
 	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.WithStack(requestError(err))
+	}
+	return resp, data, nil
+}
+
+func (c *Client) render(ctx context.Context, renderPath, dashboardId, dashboardName string, option ...Option) (*Graph, error) {
+	settings := c.snapshot()
+	endpoint, err := settings.endpointURL()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	endpoint.Path = path.Join(renderPath, dashboardId, "/", dashboardName)
+	params := endpoint.Query()
+	for _, v := range option {
+		v(&params)
+	}
+	endpoint.RawQuery = params.Encode()
+
+	var cacheKey string
+	if c.cache != nil {
+		cacheKey = c.cacheKey(endpoint.Host+endpoint.Path, params)
+		if noCache(ctx) {
+			cacheRequests.Inc("bypass")
+		} else if data, ok := c.cache.Get(cacheKey); ok {
+			cacheRequests.Inc("hit")
+			logging.Debug(ctx, "render cache hit", "path", endpoint.Path)
+			return &Graph{Graph: bytes.NewBuffer(data), URL: endpoint.String()}, nil
+		} else {
+			cacheRequests.Inc("miss")
+		}
+	}
+
+	renderType := "panel"
+	if renderPath == "/render/d/" {
+		renderType = "dashboard"
+	}
+	start := time.Now()
+	var data []byte
+	err = settings.Retry.Do(ctx, retryable, func() error {
+		resp, body, err := c.get(ctx, settings, endpoint, settings.requestTimeout(params))
+		if err != nil {
+			return err
+		}
+		data = body
+		return errors.WithStack(checkImage(resp, data))
+	})
+	if err != nil {
+		renderDuration.Observe(time.Since(start).Seconds(), renderType, "error")
+		return nil, err
+	}
+	renderDuration.Observe(time.Since(start).Seconds(), renderType, "ok")
+	logging.Debug(ctx, "rendered", "path", endpoint.Path, "duration", time.Since(start).Round(time.Millisecond), "bytes", len(data))
+	if c.cache != nil {
+		c.cache.Set(cacheKey, data)
+	}
 	return &Graph{
 		Graph: bytes.NewBuffer(data),
 		URL:   endpoint.String(),
@@ -0,0 +1,69 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+const rendererPluginPath = "/api/plugins/grafana-image-renderer/settings"
+
+// Health checks that Grafana and its database are up.
+func (c *Client) Health(ctx context.Context) error {
+	settings := c.snapshot()
+	endpoint, err := settings.endpointURL()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	endpoint.Path = path.Join(endpoint.Path, "/api/health")
+	_, data, err := c.get(ctx, settings, endpoint, settings.RenderTimeout)
+	if err != nil {
+		return err
+	}
+	var health struct {
+		Database string `json:"database"`
+	}
+	if err := json.Unmarshal(data, &health); err != nil {
+		return errors.WithStack(err)
+	}
+	if health.Database != "ok" {
+		return errors.Errorf("database is %q", health.Database)
+	}
+	return nil
+}
+
+// RendererHealth checks the image renderer: the remote renderer at rendererURL when
+// given, otherwise the renderer plugin installed in Grafana.
+func (c *Client) RendererHealth(ctx context.Context, rendererURL string) error {
+	if rendererURL == "" {
+		settings := c.snapshot()
+		endpoint, err := settings.endpointURL()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		endpoint.Path = path.Join(endpoint.Path, rendererPluginPath)
+		_, _, err = c.get(ctx, settings, endpoint, settings.RenderTimeout)
+		if e, ok := errors.Cause(err).(*Error); ok && e.Kind == ErrNotFound {
+			return errors.New("the grafana-image-renderer plugin is not installed")
+		}
+		return err
+	}
+	// The remote renderer is not sent the Grafana credentials.
+	req, err := http.NewRequest(http.MethodGet, rendererURL, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		grafanaResponses.Inc("error")
+		return errors.WithStack(requestError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.WithStack(responseError(resp))
+	}
+	return nil
+}
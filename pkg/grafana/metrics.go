@@ -0,0 +1,12 @@
+package grafana
+
+import "github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/metrics"
+
+var (
+	grafanaResponses = metrics.NewCounterVec("grasla_grafana_responses_total",
+		"Responses of Grafana by status code, or error when none was received.", "code")
+	renderDuration = metrics.NewHistogramVec("grasla_render_duration_seconds",
+		"Time to render an image with Grafana, retries included.", metrics.DefBuckets, "type", "result")
+	cacheRequests = metrics.NewCounterVec("grasla_cache_requests_total",
+		"Render cache lookups by result: hit, miss or bypass for nocache.", "result")
+)
@@ -2,13 +2,200 @@ package grafana
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func ParseTimeRange(s string) (string, error) {
-	regex := regexp.MustCompile(`^\d+([mhdyM])$`)
-	if regex.MatchString(s) {
-		return "now-" + s, nil
+var (
+	relativeRegex = regexp.MustCompile(`^\d+[smhdwMy]$`)
+	epochRegex    = regexp.MustCompile(`^\d+$`)
+	mathRegex     = regexp.MustCompile(`^([+-]\d+|/)([smhdwMy])`)
+)
+
+var absoluteLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+type TimeRange struct {
+	From string
+	To   string
+}
+
+// DefaultTimeRange is Grafana's default range of a dashboard.
+var DefaultTimeRange = TimeRange{From: "now-6h", To: "now"}
+
+func (t *TimeRange) Options() []Option {
+	return []Option{From(t.From), To(t.To)}
+}
+
+// Resolve returns the absolute start and end of the range, reading absolute times in loc.
+func (t *TimeRange) Resolve(loc *time.Location) (time.Time, time.Time, error) {
+	now := time.Now()
+	_, from, err := parseTime(t.From, now, loc, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	_, to, err := parseTime(t.To, now, loc, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return from, to, nil
+}
+
+// AbsoluteTimeRange is a range between from and to in epoch milliseconds.
+func AbsoluteTimeRange(from, to time.Time) *TimeRange {
+	return &TimeRange{
+		From: strconv.FormatInt(from.UnixNano()/int64(time.Millisecond), 10),
+		To:   strconv.FormatInt(to.UnixNano()/int64(time.Millisecond), 10),
+	}
+}
+
+// ParseTimeRange accepts `3h`, `from..to` or separate from and to arguments.
+// Each side may be a duration (`3h` is read as `now-3h`), a Grafana expression
+// like `now-1d/d`, epoch milliseconds or an absolute time like `2006-01-02T15:04`
+// which is read in loc.
+func ParseTimeRange(loc *time.Location, args ...string) (*TimeRange, error) {
+	return parseTimeRange(time.Now(), loc, args...)
+}
+
+// LoadLocation resolves an IANA timezone name. An empty name is the local timezone.
+func LoadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	return loc, nil
+}
+
+func parseTimeRange(now time.Time, loc *time.Location, args ...string) (*TimeRange, error) {
+	var from, to string
+	switch len(args) {
+	case 1:
+		if i := strings.Index(args[0], ".."); i >= 0 {
+			from, to = args[0][:i], args[0][i+2:]
+		} else {
+			from, to = args[0], "now"
+		}
+	case 2:
+		from, to = args[0], args[1]
+	default:
+		return nil, errors.New("this time range is invalid")
+	}
+
+	fromValue, fromTime, err := parseTime(from, now, loc, false)
+	if err != nil {
+		return nil, err
+	}
+	toValue, toTime, err := parseTime(to, now, loc, true)
+	if err != nil {
+		return nil, err
+	}
+	if !fromTime.Before(toTime) {
+		return nil, fmt.Errorf("time range start %q must be before end %q", from, to)
+	}
+	return &TimeRange{From: fromValue, To: toValue}, nil
+}
+
+func parseTime(s string, now time.Time, loc *time.Location, roundUp bool) (string, time.Time, error) {
+	switch {
+	case s == "":
+		return "", time.Time{}, errors.New("this time range is invalid")
+	case relativeRegex.MatchString(s):
+		s = "now-" + s
+		t, err := evalTimeExpr(s, now, loc, roundUp)
+		return s, t, err
+	case strings.HasPrefix(s, "now"):
+		t, err := evalTimeExpr(s, now, loc, roundUp)
+		return s, t, err
+	case epochRegex.MatchString(s):
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("invalid epoch milliseconds %q", s)
+		}
+		return s, time.Unix(0, ms*int64(time.Millisecond)), nil
+	}
+	for _, layout := range absoluteLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10), t, nil
+		}
+	}
+	return "", time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// evalTimeExpr evaluates Grafana date math such as `now-1d/d` so that the range can be validated.
+func evalTimeExpr(s string, now time.Time, loc *time.Location, roundUp bool) (time.Time, error) {
+	t := now.In(loc)
+	rest := strings.TrimPrefix(s, "now")
+	for rest != "" {
+		m := mathRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return time.Time{}, fmt.Errorf("invalid time expression %q", s)
+		}
+		rest = rest[len(m[0]):]
+		if m[1] == "/" {
+			t = roundTime(t, m[2], roundUp)
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time expression %q", s)
+		}
+		t = addTime(t, n, m[2])
+	}
+	return t, nil
+}
+
+func addTime(t time.Time, n int, unit string) time.Time {
+	switch unit {
+	case "s":
+		return t.Add(time.Duration(n) * time.Second)
+	case "m":
+		return t.Add(time.Duration(n) * time.Minute)
+	case "h":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "d":
+		return t.AddDate(0, 0, n)
+	case "w":
+		return t.AddDate(0, 0, 7*n)
+	case "M":
+		return t.AddDate(0, n, 0)
+	case "y":
+		return t.AddDate(n, 0, 0)
+	}
+	return t
+}
+
+func roundTime(t time.Time, unit string, roundUp bool) time.Time {
+	y, mo, d := t.Date()
+	var start time.Time
+	switch unit {
+	case "s":
+		start = time.Date(y, mo, d, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	case "m":
+		start = time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, t.Location())
+	case "h":
+		start = time.Date(y, mo, d, t.Hour(), 0, 0, 0, t.Location())
+	case "d":
+		start = time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+	case "w":
+		offset := (int(t.Weekday()) + 6) % 7
+		start = time.Date(y, mo, d-offset, 0, 0, 0, 0, t.Location())
+	case "M":
+		start = time.Date(y, mo, 1, 0, 0, 0, 0, t.Location())
+	case "y":
+		start = time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	if roundUp {
+		return addTime(start, 1, unit).Add(-time.Millisecond)
 	}
-	return "", errors.New("this time range is invalid")
+	return start
 }
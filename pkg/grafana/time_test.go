@@ -0,0 +1,97 @@
+package grafana
+
+import (
+	"testing"
+	"time"
+)
+
+// testNow is a Wednesday.
+var testNow = time.Date(2020, 3, 11, 15, 4, 5, 0, time.UTC)
+
+func TestParseTimeRange(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		loc  *time.Location
+		args []string
+		want TimeRange
+		err  bool
+	}{
+		{time.UTC, []string{"3h"}, TimeRange{"now-3h", "now"}, false},
+		{time.UTC, []string{"now-1d/d..now/d"}, TimeRange{"now-1d/d", "now/d"}, false},
+		{time.UTC, []string{"now/d..now/d"}, TimeRange{"now/d", "now/d"}, false},
+		{time.UTC, []string{"2d..1d"}, TimeRange{"now-2d", "now-1d"}, false},
+		{time.UTC, []string{"now-7d", "now-1d"}, TimeRange{"now-7d", "now-1d"}, false},
+		{time.UTC, []string{"1583884800000..1583971200000"}, TimeRange{"1583884800000", "1583971200000"}, false},
+		{time.UTC, []string{"2020-03-10..2020-03-11"}, TimeRange{"1583798400000", "1583884800000"}, false},
+		{tokyo, []string{"2020-03-10T09:00..2020-03-10T10:00"}, TimeRange{"1583798400000", "1583802000000"}, false},
+		{time.UTC, []string{"now..now-1h"}, TimeRange{}, true},
+		{time.UTC, []string{"now-1d/d..now-2d/d"}, TimeRange{}, true},
+		{time.UTC, []string{"now-1x"}, TimeRange{}, true},
+		{time.UTC, []string{"now-1d/"}, TimeRange{}, true},
+		{time.UTC, []string{"..now"}, TimeRange{}, true},
+		{time.UTC, []string{"yesterday"}, TimeRange{}, true},
+		{time.UTC, []string{"99999999999999999999"}, TimeRange{}, true},
+		{time.UTC, nil, TimeRange{}, true},
+		{time.UTC, []string{"1h", "now", "now"}, TimeRange{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeRange(testNow, tt.loc, tt.args...)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseTimeRange(%q) = %+v, want an error", tt.args, *got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTimeRange(%q): %v", tt.args, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parseTimeRange(%q) = %+v, want %+v", tt.args, *got, tt.want)
+		}
+	}
+}
+
+func TestEvalTimeExpr(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	date := func(loc *time.Location, v ...int) time.Time {
+		return time.Date(v[0], time.Month(v[1]), v[2], v[3], v[4], v[5], v[6]*int(time.Millisecond), loc)
+	}
+	tests := []struct {
+		expr    string
+		loc     *time.Location
+		roundUp bool
+		want    time.Time
+	}{
+		{"now", time.UTC, false, testNow},
+		{"now-5m", time.UTC, false, date(time.UTC, 2020, 3, 11, 14, 59, 5, 0)},
+		{"now+1h", time.UTC, false, date(time.UTC, 2020, 3, 11, 16, 4, 5, 0)},
+		{"now-1d/d", time.UTC, false, date(time.UTC, 2020, 3, 10, 0, 0, 0, 0)},
+		{"now-1d/d", time.UTC, true, date(time.UTC, 2020, 3, 10, 23, 59, 59, 999)},
+		{"now/d", time.UTC, true, date(time.UTC, 2020, 3, 11, 23, 59, 59, 999)},
+		{"now/d", tokyo, false, date(tokyo, 2020, 3, 12, 0, 0, 0, 0)},
+		{"now/w", time.UTC, false, date(time.UTC, 2020, 3, 9, 0, 0, 0, 0)},
+		{"now/w", time.UTC, true, date(time.UTC, 2020, 3, 15, 23, 59, 59, 999)},
+		{"now-1M/M", time.UTC, false, date(time.UTC, 2020, 2, 1, 0, 0, 0, 0)},
+		{"now-1M/M", time.UTC, true, date(time.UTC, 2020, 2, 29, 23, 59, 59, 999)},
+		{"now/y", time.UTC, false, date(time.UTC, 2020, 1, 1, 0, 0, 0, 0)},
+		{"now/h-2h", time.UTC, false, date(time.UTC, 2020, 3, 11, 13, 0, 0, 0)},
+		{"now-1w", time.UTC, false, date(time.UTC, 2020, 3, 4, 15, 4, 5, 0)},
+	}
+	for _, tt := range tests {
+		got, err := evalTimeExpr(tt.expr, testNow, tt.loc, tt.roundUp)
+		if err != nil {
+			t.Errorf("evalTimeExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("evalTimeExpr(%q, %s, roundUp=%t) = %s, want %s", tt.expr, tt.loc, tt.roundUp, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"now-", "now-d", "now*1d", "now/", "now-1q", "nowish"} {
+		if got, err := evalTimeExpr(expr, testNow, time.UTC, false); err == nil {
+			t.Errorf("evalTimeExpr(%q) = %s, want an error", expr, got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package grid
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	padding    = 8
+	labelScale = 2
+)
+
+var (
+	background = color.RGBA{0x18, 0x1b, 0x1f, 0xff}
+	foreground = color.RGBA{0xd8, 0xd9, 0xda, 0xff}
+)
+
+type Tile struct {
+	Label string
+	Image []byte
+}
+
+// Compose decodes PNG tiles and lays them out left to right, top to bottom in a grid
+// with the given number of columns, drawing each label above its tile.
+func Compose(tiles []Tile, columns int) ([]byte, error) {
+	if len(tiles) == 0 {
+		return nil, errors.New("no tiles to compose")
+	}
+	if columns <= 0 || columns > len(tiles) {
+		columns = len(tiles)
+	}
+
+	images := make([]image.Image, len(tiles))
+	cellWidth, cellHeight := 0, 0
+	for i, t := range tiles {
+		img, err := png.Decode(bytes.NewReader(t.Image))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s", t.Label)
+		}
+		images[i] = img
+		if w := img.Bounds().Dx(); w > cellWidth {
+			cellWidth = w
+		}
+		if h := img.Bounds().Dy(); h > cellHeight {
+			cellHeight = h
+		}
+	}
+
+	labelHeight := glyphHeight*labelScale + 2*padding
+	rows := (len(tiles) + columns - 1) / columns
+	stepX := cellWidth + padding
+	stepY := labelHeight + cellHeight + padding
+
+	dst := image.NewRGBA(image.Rect(0, 0, columns*stepX+padding, rows*stepY+padding))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+
+	for i, img := range images {
+		x := padding + (i%columns)*stepX
+		y := padding + (i/columns)*stepY
+		label := tiles[i].Label
+		for len(label) > 0 && textWidth(label, labelScale) > cellWidth {
+			label = label[:len(label)-1]
+		}
+		drawText(dst, x, y+padding, labelScale, label, foreground)
+		r := image.Rect(x, y+labelHeight, x+img.Bounds().Dx(), y+labelHeight+img.Bounds().Dy())
+		draw.Draw(dst, r, img, img.Bounds().Min, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
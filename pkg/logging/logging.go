@@ -0,0 +1,225 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "info"
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, errors.Errorf("unknown log level %q", s)
+}
+
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+var (
+	mu     sync.Mutex
+	out    io.Writer = os.Stderr
+	level            = LevelInfo
+	format           = FormatJSON
+)
+
+// Setup sets the lowest level written and the format, json or logfmt.
+func Setup(levelName, formatName string) error {
+	l, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	switch formatName {
+	case "":
+		formatName = FormatJSON
+	case FormatJSON, FormatLogfmt:
+	default:
+		return errors.Errorf("unknown log format %q", formatName)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	level, format = l, formatName
+	return nil
+}
+
+// SetOutput is where the lines are written, stderr by default.
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	out = w
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a context whose log lines carry the key value pairs.
+func WithFields(ctx context.Context, kv ...interface{}) context.Context {
+	fields := append(append([]interface{}(nil), contextFields(ctx)...), kv...)
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+func contextFields(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	return fields
+}
+
+// CopyFields gives ctx the log fields of from, so that work running on a context of
+// its own is still logged with the request it is done for.
+func CopyFields(ctx, from context.Context) context.Context {
+	return WithFields(ctx, contextFields(from)...)
+}
+
+// NewRequestID returns a random ID correlating the log lines of one request.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+func Debug(ctx context.Context, msg string, kv ...interface{}) { write(ctx, LevelDebug, msg, kv) }
+func Info(ctx context.Context, msg string, kv ...interface{})  { write(ctx, LevelInfo, msg, kv) }
+func Warn(ctx context.Context, msg string, kv ...interface{})  { write(ctx, LevelWarn, msg, kv) }
+func Error(ctx context.Context, msg string, kv ...interface{}) { write(ctx, LevelError, msg, kv) }
+
+var secretKeyRegex = regexp.MustCompile(`(?i)token|secret|password|api_?key|authorization|response_url`)
+
+// secretValueRegex matches Slack tokens and webhook URLs wherever they appear.
+var secretValueRegex = regexp.MustCompile(`xox[a-z]-[A-Za-z0-9-]+|https://hooks\.slack\.com/\S+`)
+
+const redacted = "[REDACTED]"
+
+// redact hides the value of secret keys and the secrets found in other values.
+func redact(key string, value interface{}) interface{} {
+	if secretKeyRegex.MatchString(key) {
+		return redacted
+	}
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		return value
+	}
+	return secretValueRegex.ReplaceAllString(s, redacted)
+}
+
+func write(ctx context.Context, lvl Level, msg string, kv []interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if lvl < level {
+		return
+	}
+	pairs := append([]interface{}{"time", time.Now().UTC().Format(time.RFC3339Nano), "level", lvl.String(), "msg", msg}, contextFields(ctx)...)
+	pairs = append(pairs, kv...)
+	if len(pairs)%2 != 0 {
+		pairs = append(pairs, "(missing)")
+	}
+
+	var b bytes.Buffer
+	if format == FormatLogfmt {
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			key := fmt.Sprint(pairs[i])
+			b.WriteString(key)
+			b.WriteByte('=')
+			b.WriteString(logfmtValue(redact(key, pairs[i+1])))
+		}
+	} else {
+		b.WriteByte('{')
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key := fmt.Sprint(pairs[i])
+			k, _ := json.Marshal(key)
+			b.Write(k)
+			b.WriteByte(':')
+			b.Write(jsonValue(redact(key, pairs[i+1])))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte('\n')
+	out.Write(b.Bytes())
+}
+
+func logfmtValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func jsonValue(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return b
+}
+
+// Writer logs each line written to it at lvl, for the standard log package.
+func Writer(lvl Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		write(context.Background(), lvl, strings.TrimSpace(string(p)), nil)
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,51 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+)
+
+// Policy retries a call with an exponential backoff and jitter.
+type Policy struct {
+	// Attempts is the number of calls including the first one. Less than 2 disables retries.
+	Attempts int
+	Initial  time.Duration
+	Max      time.Duration
+}
+
+// Retryable reports whether a failed call may be tried again, and how long to wait when
+// the server said so. A zero wait falls back to the backoff.
+type Retryable func(err error) (bool, time.Duration)
+
+// Do calls fn until it succeeds, retryable rejects its error, the attempts are exhausted
+// or ctx is done. The last error is returned.
+func (p Policy) Do(ctx context.Context, retryable Retryable, fn func() error) error {
+	backoff := p.Initial
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		ok, wait := retryable(err)
+		if !ok || attempt >= p.Attempts {
+			return err
+		}
+		if wait <= 0 {
+			wait = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+			if backoff *= 2; backoff > p.Max {
+				backoff = p.Max
+			}
+		}
+		logging.Warn(ctx, "retrying", "attempt", attempt, "wait", wait, "err", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package slack
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+)
+
+// usergroupTTL is how long the members of a user group are kept.
+const usergroupTTL = 5 * time.Minute
+
+type usergroupMembers struct {
+	members map[string]bool
+	expires time.Time
+}
+
+// usergroupFetch is a lookup of the members of a user group shared by the requests
+// needing them meanwhile.
+type usergroupFetch struct {
+	done    chan struct{}
+	members map[string]bool
+	err     error
+}
+
+// usergroupCache keeps the members of the user groups used by access rules.
+type usergroupCache struct {
+	mu       sync.Mutex
+	groups   map[string]usergroupMembers
+	fetching map[string]*usergroupFetch
+}
+
+// subject is the requester checked by access rules. User groups are looked up only
+// when a rule needs them, and at most once for the request, so that a failing lookup
+// does not delay it again for every alias checked.
+func (s *Slack) subject(ctx context.Context, workspace, channel, user string) *config.Subject {
+	type membership struct {
+		member bool
+		err    error
+	}
+	var mu sync.Mutex
+	checked := make(map[string]membership)
+	return &config.Subject{
+		Workspace: workspace,
+		Channel:   channel,
+		User:      user,
+		InUsergroup: func(usergroup string) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if m, ok := checked[usergroup]; ok {
+				return m.member, m.err
+			}
+			members, err := s.usergroupMembers(ctx, usergroup)
+			checked[usergroup] = membership{member: members[user], err: err}
+			return members[user], err
+		},
+	}
+}
+
+// usergroupMembers returns the members of the user group, fetched at most once per
+// usergroupTTL. Concurrent requests wait for the same lookup.
+func (s *Slack) usergroupMembers(ctx context.Context, usergroup string) (map[string]bool, error) {
+	c := &s.usergroups
+	c.mu.Lock()
+	if g, ok := c.groups[usergroup]; ok && time.Now().Before(g.expires) {
+		c.mu.Unlock()
+		return g.members, nil
+	}
+	f, fetching := c.fetching[usergroup]
+	if !fetching {
+		f = &usergroupFetch{done: make(chan struct{})}
+		if c.fetching == nil {
+			c.fetching = make(map[string]*usergroupFetch)
+		}
+		c.fetching[usergroup] = f
+	}
+	c.mu.Unlock()
+
+	if !fetching {
+		f.members, f.err = s.fetchUsergroupMembers(ctx, usergroup)
+		c.mu.Lock()
+		delete(c.fetching, usergroup)
+		if f.err == nil {
+			if c.groups == nil {
+				c.groups = make(map[string]usergroupMembers)
+			}
+			c.groups[usergroup] = usergroupMembers{members: f.members, expires: time.Now().Add(usergroupTTL)}
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}
+
+	select {
+	case <-f.done:
+		return f.members, f.err
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+}
+
+func (s *Slack) fetchUsergroupMembers(ctx context.Context, usergroup string) (map[string]bool, error) {
+	var users []string
+	err := s.lookup(ctx, "usergroups.users.list", func(ctx context.Context) error {
+		var err error
+		users, err = s.api().GetUserGroupMembersContext(ctx, usergroup)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool, len(users))
+	for _, u := range users {
+		members[u] = true
+	}
+	return members, nil
+}
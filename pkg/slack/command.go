@@ -0,0 +1,188 @@
+package slack
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/nlopes/slack"
+)
+
+// command is a parsed slash command text: positional arguments and `key=value` flags.
+type command struct {
+	args  []string
+	flags map[string][]string
+}
+
+// quotes maps opening quotes to closing ones. Slack clients may replace straight quotes with curly ones.
+var quotes = map[rune]rune{'"': '"', '\'': '\'', '“': '”', '‘': '’'}
+
+type token struct {
+	value string
+	// eq is the index of the first `=` outside quotes, or -1.
+	eq int
+}
+
+// tokenize splits text on whitespace. Single or double quotes group words and a
+// backslash escapes the next character, so `host="web 01"` is one token.
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	var cur strings.Builder
+	var quote rune
+	inToken, escaped := false, false
+	eq := -1
+	for _, r := range text {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inToken = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quotes[r] != 0:
+			quote, inToken = quotes[r], true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, token{value: cur.String(), eq: eq})
+				cur.Reset()
+				inToken, eq = false, -1
+			}
+		default:
+			if r == '=' && eq < 0 {
+				eq = cur.Len()
+			}
+			cur.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("token %d %q: missing closing %c", len(tokens)+1, cur.String(), quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("token %d %q: trailing backslash", len(tokens)+1, cur.String())
+	}
+	if inToken {
+		tokens = append(tokens, token{value: cur.String(), eq: eq})
+	}
+	return tokens, nil
+}
+
+func parseCommand(text string) (*command, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	cmd := &command{flags: make(map[string][]string)}
+	for i, t := range tokens {
+		if t.eq < 0 {
+			cmd.args = append(cmd.args, t.value)
+			continue
+		}
+		key, value := t.value[:t.eq], t.value[t.eq+1:]
+		if key == "" {
+			return nil, fmt.Errorf("token %d %q: missing key before `=`", i+1, t.value)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("token %d %q: missing value after `=`", i+1, t.value)
+		}
+		cmd.flags[key] = append(cmd.flags[key], value)
+	}
+	return cmd, nil
+}
+
+type subcommand struct {
+	name    string
+	usage   string
+	summary string
+	run     func(s *Slack, w http.ResponseWriter, r *http.Request, slackRes slack.SlashCommand, cmd *command)
+}
+
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{
+			name:    "list",
+			usage:   "list [page]",
+			summary: "List every graph alias and group.",
+			run: func(s *Slack, w http.ResponseWriter, r *http.Request, slackRes slack.SlashCommand, cmd *command) {
+				s.listCommand(w, s.subject(r.Context(), slackRes.TeamID, slackRes.ChannelID, slackRes.UserID), cmd.args)
+			},
+		},
+		{
+			name:    "search",
+			usage:   "search <text> [page]",
+			summary: "Search aliases, dashboard names and panel titles.",
+			run: func(s *Slack, w http.ResponseWriter, r *http.Request, slackRes slack.SlashCommand, cmd *command) {
+				s.searchCommand(w, s.subject(r.Context(), slackRes.TeamID, slackRes.ChannelID, slackRes.UserID), cmd.args)
+			},
+		},
+		{
+			name:    "help",
+			usage:   "help [subcommand]",
+			summary: "Show this help or the help of a subcommand.",
+			run: func(s *Slack, w http.ResponseWriter, _ *http.Request, _ slack.SlashCommand, cmd *command) {
+				s.responseWithMessage(helpMessage(cmd.args), w)
+			},
+		},
+	}
+}
+
+const graphUsage = "<alias> [from] [to] [tz=<timezone>] [width=<px>] [height=<px>] [theme=light|dark] [scale=<n>] [timeout=<sec>] [<var>=<value>,...] [nocache]"
+
+const graphHelp = `Render a graph alias or group and post it to this channel.
+Time range: ` + "`3h`" + `, ` + "`now-1d/d now/d`" + `, ` + "`2026-10-01T10:00..2026-10-01T12:00`" + ` or epoch milliseconds.
+Any other ` + "`key=value`" + ` sets a template variable, e.g. ` + "`host=web01,web02`" + `.
+` + "`nocache`" + ` renders again instead of using a cached image.
+Quote values containing spaces: ` + "`host=\"web 01\"`" + `.`
+
+// dispatch runs the subcommand named by the first argument, or renders a graph.
+func (s *Slack) dispatch(w http.ResponseWriter, r *http.Request, slackRes slack.SlashCommand) {
+	// Slack escapes &, < and > in the command text.
+	cmd, err := parseCommand(html.UnescapeString(slackRes.Text))
+	if err != nil {
+		s.responseWithMessage(fmt.Sprintf("invalid arguments: %s", err), w)
+		return
+	}
+	if len(cmd.args) == 0 && len(cmd.flags) == 0 {
+		s.responseWithMessage(helpMessage(nil), w)
+		return
+	}
+	if len(cmd.args) > 0 {
+		for _, sub := range subcommands {
+			if sub.name == cmd.args[0] {
+				cmd.args = cmd.args[1:]
+				sub.run(s, w, r, slackRes, cmd)
+				return
+			}
+		}
+	}
+	s.graphCommand(w, r, slackRes, cmd)
+}
+
+func helpMessage(args []string) string {
+	prefix := InvokeSlackGrafanaImageRenderCommand + " "
+	if len(args) > 0 {
+		for _, sub := range subcommands {
+			if sub.name == args[0] {
+				return fmt.Sprintf("`%s%s`\n%s", prefix, sub.usage, sub.summary)
+			}
+		}
+		if args[0] != "graph" {
+			return fmt.Sprintf("no subcommand %q, see `%shelp`", args[0], prefix)
+		}
+		return fmt.Sprintf("`%s%s`\n%s", prefix, graphUsage, graphHelp)
+	}
+	lines := []string{fmt.Sprintf("`%s%s`\n%s", prefix, graphUsage, graphHelp), ""}
+	for _, sub := range subcommands {
+		lines = append(lines, fmt.Sprintf("`%s%s` %s", prefix, sub.usage, sub.summary))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,95 @@
+package slack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text  string
+		args  []string
+		flags map[string][]string
+	}{
+		{"", nil, map[string][]string{}},
+		{"  cpu \t 3h ", []string{"cpu", "3h"}, map[string][]string{}},
+		{"cpu now-1d/d now/d", []string{"cpu", "now-1d/d", "now/d"}, map[string][]string{}},
+		{"cpu host=web01,web02 tz=Asia/Tokyo", []string{"cpu"}, map[string][]string{"host": {"web01,web02"}, "tz": {"Asia/Tokyo"}}},
+		{"cpu host=a host=b", []string{"cpu"}, map[string][]string{"host": {"a", "b"}}},
+		{`cpu host="web 01"`, []string{"cpu"}, map[string][]string{"host": {"web 01"}}},
+		{`cpu host='web "01"'`, []string{"cpu"}, map[string][]string{"host": {`web "01"`}}},
+		{"cpu host=“web 01”", []string{"cpu"}, map[string][]string{"host": {"web 01"}}},
+		{"cpu host=‘web 01’", []string{"cpu"}, map[string][]string{"host": {"web 01"}}},
+		{`cpu host=web\ 01`, []string{"cpu"}, map[string][]string{"host": {"web 01"}}},
+		{`cpu query="a=b"`, []string{"cpu"}, map[string][]string{"query": {"a=b"}}},
+		{`cpu query=a=b`, []string{"cpu"}, map[string][]string{"query": {"a=b"}}},
+		{`cpu "a=b"`, []string{"cpu", "a=b"}, map[string][]string{}},
+		{`cpu a\=b`, []string{"cpu", "a=b"}, map[string][]string{}},
+		{`cpu ""`, []string{"cpu", ""}, map[string][]string{}},
+		{`cpu a"b c"d`, []string{"cpu", "ab cd"}, map[string][]string{}},
+		{`search "disk usage"`, []string{"search", "disk usage"}, map[string][]string{}},
+	}
+	for _, tt := range tests {
+		cmd, err := parseCommand(tt.text)
+		if err != nil {
+			t.Errorf("parseCommand(%q): %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd.args, tt.args) {
+			t.Errorf("parseCommand(%q) args = %q, want %q", tt.text, cmd.args, tt.args)
+		}
+		if !reflect.DeepEqual(cmd.flags, tt.flags) {
+			t.Errorf("parseCommand(%q) flags = %q, want %q", tt.text, cmd.flags, tt.flags)
+		}
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{`cpu host="web 01`, `token 2 "host=web 01": missing closing "`},
+		{`cpu 'web`, `token 2 "web": missing closing '`},
+		{"cpu host=“web 01", `token 2 "host=web 01": missing closing ”`},
+		{`cpu host=web\`, `token 2 "host=web": trailing backslash`},
+		{"cpu =web", `token 2 "=web": missing key before ` + "`=`"},
+		{"cpu 3h host=", `token 3 "host=": missing value after ` + "`=`"},
+	}
+	for _, tt := range tests {
+		cmd, err := parseCommand(tt.text)
+		if err == nil {
+			t.Errorf("parseCommand(%q) = %+v, want an error", tt.text, cmd)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parseCommand(%q) error = %q, want %q", tt.text, err, tt.err)
+		}
+	}
+}
+
+func TestSubcommandsReserved(t *testing.T) {
+	var names []string
+	for _, sub := range subcommands {
+		names = append(names, sub.name)
+	}
+	if !reflect.DeepEqual(names, config.ReservedNames) {
+		t.Errorf("subcommands = %q, want config.ReservedNames %q", names, config.ReservedNames)
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	for _, arg := range []string{"disk", "disk usage", "a=b", `web "01"`, `a\b`, "‘web’", "tab\there", ""} {
+		cmd, err := parseCommand("search " + quoteArg(arg) + " 2")
+		if err != nil {
+			t.Errorf("parseCommand(search %s): %v", quoteArg(arg), err)
+			continue
+		}
+		if want := []string{"search", arg, "2"}; !reflect.DeepEqual(cmd.args, want) {
+			t.Errorf("parseCommand(search %s) args = %q, want %q", quoteArg(arg), cmd.args, want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/grafana"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+)
+
+var varNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// graphRequest is what the user asked for. It is kept in the buttons of a posted
+// graph so that an interaction can render it again.
+type graphRequest struct {
+	Name  string              `json:"n"`
+	Range []string            `json:"r,omitempty"`
+	Flags map[string][]string `json:"f,omitempty"`
+	// NoCache forces a fresh render. It is not kept in buttons.
+	NoCache bool `json:"-"`
+}
+
+// graphJob is a validated graphRequest ready to be rendered.
+type graphJob struct {
+	request   *graphRequest
+	group     *config.Group
+	timeRange *grafana.TimeRange
+	loc       *time.Location
+	opts      []grafana.Option
+}
+
+// graphCommand renders the alias or group named by the first argument.
+func (s *Slack) graphCommand(w http.ResponseWriter, r *http.Request, slackRes slack.SlashCommand, cmd *command) {
+	if len(cmd.args) == 0 {
+		s.responseWithMessage(fmt.Sprintf("missing alias, see `%s help`", InvokeSlackGrafanaImageRenderCommand), w)
+		return
+	}
+	req := &graphRequest{Name: cmd.args[0], Flags: cmd.flags}
+	for _, arg := range cmd.args[1:] {
+		if arg == "nocache" {
+			req.NoCache = true
+			continue
+		}
+		req.Range = append(req.Range, arg)
+	}
+	subject := s.subject(r.Context(), slackRes.TeamID, slackRes.ChannelID, slackRes.UserID)
+	job, err := s.prepareGraph(r.Context(), req, subject)
+	if err != nil {
+		s.responseWithMessage(err.Error(), w)
+		return
+	}
+	graphRequests.Inc(req.Name, slackRes.ChannelID)
+
+	reqCtx := r.Context()
+	task, position, err := s.queue.submit(job.key(), func(ctx context.Context) ([]groupGraph, error) {
+		return s.renderJob(logging.CopyFields(ctx, reqCtx), job)
+	})
+	if err != nil {
+		s.responseWithMessage(err.Error(), w)
+		return
+	}
+
+	s.startJob(reqCtx, slackRes.ResponseURL, req.Name, true, func(ctx context.Context) error {
+		graphs, err := task.wait(ctx)
+		if err != nil {
+			return err
+		}
+		return s.postGraph(ctx, slackRes.ChannelID, job, graphs)
+	})
+	if position > 0 {
+		s.responseWithMessage(fmt.Sprintf("taking graph... (position %d in queue)", position), w)
+		return
+	}
+	s.responseWithMessage("taking graph...", w)
+}
+
+// key identifies what is rendered for the job, so that identical requests share one render.
+func (j *graphJob) key() string {
+	params := url.Values{}
+	for _, opt := range j.opts {
+		opt(&params)
+	}
+	kind := "alias:"
+	if j.group != nil {
+		kind = "group:"
+	}
+	key := kind + j.request.Name + "?" + params.Encode()
+	if j.request.NoCache {
+		key += "#nocache"
+	}
+	return key
+}
+
+// prepareGraph checks that subject may render req and validates it. Its errors are meant for the user.
+func (s *Slack) prepareGraph(ctx context.Context, req *graphRequest, subject *config.Subject) (*graphJob, error) {
+	if !config.Allowed(req.Name, subject) {
+		logging.Warn(ctx, "access denied", "name", req.Name)
+		return nil, fmt.Errorf("you are not allowed to render %q here", req.Name)
+	}
+	if len(req.Range) > 2 {
+		return nil, fmt.Errorf("unexpected argument %q: a time range has at most two times", req.Range[2])
+	}
+
+	var render config.Render
+	vars := make(map[string][]string)
+	for k, values := range req.Flags {
+		switch {
+		case k == "tz":
+		case config.IsRenderKey(k):
+			if err := render.Set(k, values[len(values)-1]); err != nil {
+				return nil, fmt.Errorf("argument %q is invalid: %s", k+"="+values[len(values)-1], err)
+			}
+		default:
+			name := strings.TrimPrefix(k, "var-")
+			if !varNameRegex.MatchString(name) {
+				return nil, fmt.Errorf("unknown argument %q", k)
+			}
+			for _, v := range values {
+				vars[name] = append(vars[name], strings.Split(v, ",")...)
+			}
+		}
+	}
+
+	job := &graphJob{request: req}
+	names := []string{req.Name}
+	if group, err := config.GetGroup(req.Name); err == nil {
+		job.group = group
+		names = group.Dashboards
+	}
+	dashboard, err := config.GetDashboard(names[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s", noGraphMessage(req.Name, subject))
+	}
+
+	var inlineTz string
+	if v := req.Flags["tz"]; len(v) > 0 {
+		inlineTz = v[len(v)-1]
+	}
+	tz := s.timezone(ctx, dashboard, inlineTz, subject.User)
+	job.loc, err = grafana.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("argument \"tz\" is invalid: %s", err)
+	}
+
+	if len(req.Range) > 0 {
+		job.timeRange, err = grafana.ParseTimeRange(job.loc, req.Range...)
+		if err != nil {
+			return nil, fmt.Errorf("time range is invalid: %s", err)
+		}
+		job.opts = append(job.opts, job.timeRange.Options()...)
+	}
+	render.Timezone = tz
+	job.opts = append(job.opts, grafana.RenderOptions(&render)...)
+	for name, values := range vars {
+		job.opts = append(job.opts, grafana.Var(name, values...))
+	}
+	return job, nil
+}
+
+// renderJob renders every graph of the job. It is run by the render queue.
+func (s *Slack) renderJob(ctx context.Context, job *graphJob) ([]groupGraph, error) {
+	if job.request.NoCache {
+		ctx = grafana.NoCache(ctx)
+	}
+	if job.group != nil {
+		return s.renderGroup(ctx, job.group, job.opts)
+	}
+	graph, err := s.render(ctx, job.request.Name, job.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return []groupGraph{{name: job.request.Name, graph: graph}}, nil
+}
+
+// render renders the alias name once a render slot of the queue is free.
+func (s *Slack) render(ctx context.Context, name string, opts ...grafana.Option) (*grafana.Graph, error) {
+	release, err := s.queue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return s.grafana.Render(ctx, name, opts...)
+}
+
+// queueJob renders the job through the render queue and waits for it.
+func (s *Slack) queueJob(ctx context.Context, job *graphJob) ([]groupGraph, error) {
+	task, _, err := s.queue.submit(job.key(), func(qctx context.Context) ([]groupGraph, error) {
+		return s.renderJob(logging.CopyFields(qctx, ctx), job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return task.wait(ctx)
+}
+
+// postGraph posts the rendered graphs of the job to channel. Single graphs get time-shift
+// buttons when a public URL is configured, otherwise they are uploaded as files.
+func (s *Slack) postGraph(ctx context.Context, channel string, job *graphJob, graphs []groupGraph) error {
+	if job.group != nil {
+		return s.postGroup(ctx, channel, job.group, graphs)
+	}
+	graph := graphs[0].graph
+	if !s.interactive() {
+		return s.uploadGraph(ctx, channel, graph)
+	}
+	return s.postInteractiveGraph(ctx, channel, "", job, graph)
+}
+
+// timezone picks the render timezone: an inline `tz=` argument, then the invoking
+// user's Slack timezone if enabled, then the dashboard and the global Grafana setting.
+func (s *Slack) timezone(ctx context.Context, dashboard *config.Dashboard, inline, userID string) string {
+	if inline != "" {
+		return inline
+	}
+	if config.Current().Slack.UseUserTimezone {
+		tz, err := s.userTimezone(ctx, userID)
+		if err != nil {
+			logging.Warn(ctx, "cannot get the user timezone", "err", err)
+		} else if tz != "" {
+			return tz
+		}
+	}
+	if dashboard.Timezone != "" {
+		return dashboard.Timezone
+	}
+	return config.Current().Grafana.Timezone
+}
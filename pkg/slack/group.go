@@ -0,0 +1,124 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/grafana"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/grid"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+)
+
+type groupGraph struct {
+	name  string
+	graph *grafana.Graph
+	// err is why the graph could not be rendered. The group is posted without it.
+	err error
+}
+
+// groupFailure reports the graphs a group was posted without.
+type groupFailure struct {
+	graphs []groupGraph
+}
+
+func (e *groupFailure) Error() string {
+	lines := make([]string, len(e.graphs))
+	for i, g := range e.graphs {
+		lines[i] = fmt.Sprintf("%s failed: %s", g.name, errorMessage(g.err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderGroup renders every alias of the group concurrently, as far as render slots are
+// free, and returns them in group order, the failed ones with their error. It fails when
+// no graph could be rendered.
+func (s *Slack) renderGroup(ctx context.Context, group *config.Group, opts []grafana.Option) ([]groupGraph, error) {
+	result := make([]groupGraph, len(group.Dashboards))
+	var wg sync.WaitGroup
+	for i, name := range group.Dashboards {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			graph, err := s.render(ctx, name, opts...)
+			result[i] = groupGraph{name: name, graph: graph, err: err}
+		}(i, name)
+	}
+	wg.Wait()
+
+	rendered := 0
+	for _, g := range result {
+		if g.err != nil {
+			logging.Warn(ctx, "graph of group failed", "group", group.Name, "name", g.name, "err", g.err)
+			continue
+		}
+		rendered++
+	}
+	if rendered == 0 {
+		return nil, errors.Wrapf(result[0].err, "group %s: no graph could be rendered", group.Name)
+	}
+	return result, nil
+}
+
+// postGroup posts the rendered graphs of the group, then returns a groupFailure when
+// some of them failed.
+func (s *Slack) postGroup(ctx context.Context, channel string, group *config.Group, graphs []groupGraph) error {
+	var rendered, failed []groupGraph
+	for _, g := range graphs {
+		if g.err != nil {
+			failed = append(failed, g)
+		} else {
+			rendered = append(rendered, g)
+		}
+	}
+	var err error
+	if group.IsGrid() {
+		err = s.uploadGrid(ctx, channel, group, rendered)
+	} else {
+		err = s.uploadGraphs(ctx, channel, group, rendered)
+	}
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return &groupFailure{graphs: failed}
+	}
+	return nil
+}
+
+func (s *Slack) uploadGrid(ctx context.Context, channel string, group *config.Group, graphs []groupGraph) error {
+	tiles := make([]grid.Tile, len(graphs))
+	names := make([]string, len(graphs))
+	for i, g := range graphs {
+		tiles[i] = grid.Tile{Label: g.name, Image: g.graph.Graph.Bytes()}
+		names[i] = g.name
+	}
+	b, err := grid.Compose(tiles, group.Columns)
+	if err != nil {
+		return err
+	}
+	comment := fmt.Sprintf("%s: %s", group.Name, strings.Join(names, ", "))
+	_, err = s.uploadImage(ctx, []string{channel}, comment, b)
+	return err
+}
+
+// uploadGraphs uploads every graph privately and shares them in one message by their permalinks.
+func (s *Slack) uploadGraphs(ctx context.Context, channel string, group *config.Group, graphs []groupGraph) error {
+	lines := []string{group.Name}
+	for _, g := range graphs {
+		file, err := s.uploadImage(ctx, nil, "", g.graph.Graph.Bytes())
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", g.name, file.Permalink))
+	}
+	return s.call(ctx, "chat.postMessage", func(ctx context.Context) error {
+		_, _, err := s.api().PostMessageContext(ctx, channel, slack.MsgOptionText(strings.Join(lines, "\n"), false))
+		return errors.WithStack(err)
+	})
+}
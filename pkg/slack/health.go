@@ -0,0 +1,116 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+)
+
+// healthTimeout limits each dependency check of /readyz.
+const healthTimeout = 5 * time.Second
+
+type dependency struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+type readiness struct {
+	Status       string                `json:"status"`
+	CheckedAt    time.Time             `json:"checked_at"`
+	Dependencies map[string]dependency `json:"dependencies"`
+}
+
+// healthCache keeps the last readiness so that frequent probes do not load Grafana and Slack.
+type healthCache struct {
+	mu   sync.Mutex
+	last *readiness
+}
+
+func (s *Slack) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Slack) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ready := s.readiness(r.Context())
+	status := http.StatusOK
+	if ready.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, ready)
+}
+
+// readiness checks Grafana, its image renderer and Slack, or returns the last result
+// while it is more recent than the health cache TTL.
+func (s *Slack) readiness(ctx context.Context) *readiness {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	if s.health.last != nil && time.Since(s.health.last.CheckedAt) < config.Current().Health.CacheTTL.Duration() {
+		return s.health.last
+	}
+
+	rendererURL := config.Current().Grafana.RendererURL
+	checks := map[string]func(ctx context.Context) error{
+		"slack": func(ctx context.Context) error {
+			_, err := s.api().AuthTestContext(ctx)
+			return errors.WithStack(err)
+		},
+	}
+	for name, g := range s.grafana {
+		g := g
+		suffix := ""
+		if name != "" {
+			suffix = "/" + name
+		}
+		checks["grafana"+suffix] = g.Health
+		// A remote renderer is shared, otherwise each backend has the plugin.
+		if rendererURL == "" || name == "" {
+			checks["renderer"+suffix] = func(ctx context.Context) error {
+				return g.RendererHealth(ctx, rendererURL)
+			}
+		}
+	}
+	ready := &readiness{Status: "ok", CheckedAt: time.Now(), Dependencies: make(map[string]dependency)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check(ctx)
+			d := dependency{Status: "ok", Latency: time.Since(start).Round(time.Millisecond).String()}
+			if err != nil {
+				d.Status, d.Error = "fail", errors.Cause(err).Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			ready.Dependencies[name] = d
+			if err != nil {
+				ready.Status = "fail"
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	s.health.last = ready
+	return ready
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,46 @@
+package slack
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/cache"
+)
+
+const imagePath = "/images/"
+
+// imageStore serves rendered graphs under unguessable URLs for Block Kit image blocks,
+// which need an image URL Slack can fetch. The least recently served images are dropped
+// beyond its caps.
+type imageStore struct {
+	images *cache.Memory
+}
+
+func newImageStore(ttl time.Duration, maxEntries int, maxBytes int64) *imageStore {
+	return &imageStore{images: cache.NewMemory(ttl, maxEntries, maxBytes)}
+}
+
+// put stores data and returns its ID.
+func (s *imageStore) put(data []byte) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	s.images.Set(id, data)
+	return id, nil
+}
+
+func (s *imageStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, imagePath), ".png")
+	data, ok := s.images.Get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data)
+}
@@ -0,0 +1,191 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/grafana"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+)
+
+const (
+	actionShift   = "shift"
+	actionZoomOut = "zoom_out"
+	actionRefresh = "refresh"
+	actionOpen    = "open"
+
+	shiftDuration = time.Hour
+)
+
+// interactive reports whether graphs are posted as Block Kit messages with buttons.
+func (s *Slack) interactive() bool {
+	return config.Current().Slack.PublicURL != ""
+}
+
+// postInteractiveGraph posts graph with time-shift buttons, or replaces the message ts when given.
+func (s *Slack) postInteractiveGraph(ctx context.Context, channel, ts string, job *graphJob, graph *grafana.Graph) error {
+	id, err := s.images.put(graph.Graph.Bytes())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	imageURL := strings.TrimSuffix(config.Current().Slack.PublicURL, "/") + imagePath + id + ".png"
+	title := fmt.Sprintf("%s %s", job.request.Name, rangeLabel(job))
+
+	state, err := json.Marshal(job.request)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	value := string(state)
+	buttons := []slack.BlockElement{
+		slack.NewButtonBlockElement(actionShift, value, slack.NewTextBlockObject(slack.PlainTextType, "-1h", false, false)),
+		slack.NewButtonBlockElement(actionZoomOut, value, slack.NewTextBlockObject(slack.PlainTextType, "x2 zoom out", false, false)),
+		slack.NewButtonBlockElement(actionRefresh, value, slack.NewTextBlockObject(slack.PlainTextType, "refresh", false, false)),
+	}
+	if dashboardURL, err := s.grafana.DashboardURL(job.request.Name, job.opts...); err == nil {
+		open := slack.NewButtonBlockElement(actionOpen, "", slack.NewTextBlockObject(slack.PlainTextType, "open in Grafana", false, false))
+		open.URL = dashboardURL
+		buttons = append(buttons, open)
+	}
+
+	blocks := slack.MsgOptionBlocks(
+		slack.NewImageBlock(imageURL, job.request.Name, "", slack.NewTextBlockObject(slack.PlainTextType, title, false, false)),
+		slack.NewActionBlock("graph", buttons...),
+	)
+	text := slack.MsgOptionText(title, false)
+	method := "chat.postMessage"
+	if ts != "" {
+		method = "chat.update"
+	}
+	return s.call(ctx, method, func(ctx context.Context) error {
+		var err error
+		if ts == "" {
+			_, _, err = s.api().PostMessageContext(ctx, channel, blocks, text)
+		} else {
+			_, _, _, err = s.api().UpdateMessageContext(ctx, channel, ts, blocks, text)
+		}
+		return errors.WithStack(err)
+	})
+}
+
+func rangeLabel(job *graphJob) string {
+	if job.timeRange == nil {
+		return "(dashboard time range)"
+	}
+	return fmt.Sprintf("%s to %s", formatTime(job.timeRange.From, job.loc), formatTime(job.timeRange.To, job.loc))
+}
+
+// formatTime shows epoch milliseconds as a readable time and keeps other expressions as they are.
+func formatTime(value string, loc *time.Location) string {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).In(loc).Format("2006-01-02 15:04 MST")
+}
+
+func (s *Slack) interactionHandler(w http.ResponseWriter, r *http.Request) {
+	verifier, err := slack.NewSecretsVerifier(r.Header, s.signingSecret())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	r.Body = ioutil.NopCloser(io.TeeReader(r.Body, &verifier))
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = verifier.Ensure(); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(r.PostForm.Get("payload")), &callback); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if callback.Type != slack.InteractionTypeBlockActions || len(callback.ActionCallback.BlockActions) == 0 {
+		return
+	}
+	action := callback.ActionCallback.BlockActions[0]
+	if action.ActionID == actionOpen {
+		return
+	}
+	ctx := logging.WithFields(r.Context(),
+		"request_id", logging.NewRequestID(),
+		"team", callback.Team.ID,
+		"channel", callback.Channel.ID,
+		"user", callback.User.ID,
+	)
+	req := &graphRequest{}
+	if err := json.Unmarshal([]byte(action.Value), req); err != nil {
+		logging.Warn(ctx, "invalid button value", "err", err)
+		return
+	}
+	logging.Info(ctx, "interaction", "action", action.ActionID, "name", req.Name)
+
+	graphRequests.Inc(req.Name, callback.Channel.ID)
+	s.startJob(ctx, callback.ResponseURL, req.Name, false, func(ctx context.Context) error {
+		subject := s.subject(ctx, callback.Team.ID, callback.Channel.ID, callback.User.ID)
+		return s.updateGraph(ctx, callback.Channel.ID, callback.Message.Timestamp, subject, action.ActionID, req)
+	})
+}
+
+// updateGraph renders req again with the time range changed by action and updates the message ts.
+func (s *Slack) updateGraph(ctx context.Context, channel, ts string, subject *config.Subject, action string, req *graphRequest) error {
+	req.NoCache = action == actionRefresh
+	job, err := s.prepareGraph(ctx, req, subject)
+	if err != nil {
+		return err
+	}
+	// The configuration may have been reloaded since the message was posted.
+	if job.group != nil {
+		return fmt.Errorf("%q is now a group, run the command again", req.Name)
+	}
+	if action == actionShift || action == actionZoomOut {
+		timeRange := job.timeRange
+		if timeRange == nil {
+			timeRange = &grafana.DefaultTimeRange
+		}
+		from, to, err := timeRange.Resolve(job.loc)
+		if err != nil {
+			return err
+		}
+		switch action {
+		case actionShift:
+			from, to = from.Add(-shiftDuration), to.Add(-shiftDuration)
+		case actionZoomOut:
+			width := to.Sub(from)
+			from, to = from.Add(-width/2), to.Add(width/2)
+			if now := time.Now(); to.After(now) {
+				from, to = from.Add(-to.Sub(now)), now
+			}
+		}
+		shifted := grafana.AbsoluteTimeRange(from, to)
+		req.Range = []string{shifted.From, shifted.To}
+		if job, err = s.prepareGraph(ctx, req, subject); err != nil {
+			return err
+		}
+	}
+
+	graphs, err := s.queueJob(ctx, job)
+	if err != nil {
+		return err
+	}
+	return s.postInteractiveGraph(ctx, channel, ts, job, graphs[0].graph)
+}
@@ -0,0 +1,165 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nlopes/slack"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+)
+
+const listPageSize = 10
+
+// listCommand handles `/graph list [page]`. It lists what subject may render.
+func (s *Slack) listCommand(w http.ResponseWriter, subject *config.Subject, args []string) {
+	page, err := parsePage(args)
+	if err != nil {
+		s.responseWithMessage(err.Error(), w)
+		return
+	}
+	var entries []string
+	groups, dashboards := config.ListGroups(), config.List()
+	for _, v := range groups {
+		if config.Allowed(v.Name, subject) {
+			entries = append(entries, groupEntry(&v))
+		}
+	}
+	for _, v := range dashboards {
+		if config.Allowed(v.Name, subject) {
+			entries = append(entries, dashboardEntry(&v))
+		}
+	}
+	if len(entries) == 0 {
+		if len(groups) == 0 && len(dashboards) == 0 {
+			s.responseWithMessage("no graph is configured", w)
+		} else {
+			s.responseWithMessage("no graph may be rendered here", w)
+		}
+		return
+	}
+	s.responseWithList(w, "Graphs", "list", entries, page)
+}
+
+// searchCommand handles `/graph search <text> [page]`. It finds what subject may render.
+func (s *Slack) searchCommand(w http.ResponseWriter, subject *config.Subject, args []string) {
+	if len(args) == 0 {
+		s.responseWithMessage(helpMessage([]string{"search"}), w)
+		return
+	}
+	page, err := parsePage(args[1:])
+	if err != nil {
+		s.responseWithMessage(err.Error(), w)
+		return
+	}
+	var entries []string
+	for _, v := range config.Search(args[0]) {
+		if config.Allowed(v.Name, subject) {
+			entries = append(entries, dashboardEntry(&v))
+		}
+	}
+	if len(entries) == 0 {
+		s.responseWithMessage(fmt.Sprintf("no graph matches %q", args[0]), w)
+		return
+	}
+	s.responseWithList(w, fmt.Sprintf("Graphs matching %q", args[0]), "search "+quoteArg(args[0]), entries, page)
+}
+
+// quoteArg quotes arg when tokenize would not read it back as one argument.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, `\="'“‘`) && strings.IndexFunc(arg, unicode.IsSpace) < 0 {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func parsePage(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	page, err := strconv.Atoi(args[0])
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("page %q is invalid: must be a positive number", args[0])
+	}
+	if len(args) > 1 {
+		return 0, fmt.Errorf("unexpected argument %q", args[1])
+	}
+	return page, nil
+}
+
+func dashboardEntry(d *config.Dashboard) string {
+	title := d.Title
+	if title == "" {
+		title = d.DashboardName
+	}
+	if d.IsDashboard() {
+		return fmt.Sprintf("`%s` %s (dashboard)", d.Name, title)
+	}
+	return fmt.Sprintf("`%s` %s (panel %s)", d.Name, title, d.PanelID)
+}
+
+func groupEntry(g *config.Group) string {
+	return fmt.Sprintf("`%s` group of %s", g.Name, strings.Join(g.Dashboards, ", "))
+}
+
+// noGraphMessage tells that name is unknown and suggests similar aliases subject may render.
+func noGraphMessage(name string, subject *config.Subject) string {
+	var suggestions []string
+	for _, v := range config.Suggest(name) {
+		if config.Allowed(v, subject) {
+			suggestions = append(suggestions, v)
+		}
+	}
+	if len(suggestions) == 0 {
+		return fmt.Sprintf("no graph %q, see `%s list`", name, InvokeSlackGrafanaImageRenderCommand)
+	}
+	for i, v := range suggestions {
+		suggestions[i] = "`" + v + "`"
+	}
+	return fmt.Sprintf("no graph %q, did you mean %s?", name, strings.Join(suggestions, ", "))
+}
+
+func (s *Slack) responseWithList(w http.ResponseWriter, title, command string, entries []string, page int) {
+	pages := (len(entries) + listPageSize - 1) / listPageSize
+	if pages == 0 {
+		pages = 1
+	}
+	if page > pages {
+		s.responseWithMessage(fmt.Sprintf("page is out of range: %d/%d", page, pages), w)
+		return
+	}
+	start := (page - 1) * listPageSize
+	end := start + listPageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	text := fmt.Sprintf("*%s* (%d)", title, len(entries))
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, strings.Join(entries[start:end], "\n"), false, false), nil, nil),
+	}
+	footer := fmt.Sprintf("Page %d/%d", page, pages)
+	if page < pages {
+		footer += fmt.Sprintf(", next: `%s %s %d`", InvokeSlackGrafanaImageRenderCommand, command, page+1)
+	}
+	blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, footer, false, false)))
+	s.responseWithBlocks(text, w, blocks...)
+}
+
+func (s *Slack) responseWithBlocks(text string, w http.ResponseWriter, blocks ...slack.Block) {
+	params := &slack.Msg{}
+	params.Text = text
+	params.Blocks = slack.Blocks{BlockSet: blocks}
+	b, err := json.Marshal(params)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,12 @@
+package slack
+
+import "github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/metrics"
+
+var (
+	graphRequests = metrics.NewCounterVec("grasla_requests_total",
+		"Graph requests by alias or group and channel, from commands and buttons.", "alias", "channel")
+	slackFailures = metrics.NewCounterVec("grasla_slack_failures_total",
+		"Slack API calls failing after retries, by method. Upload failures are files.upload.", "method")
+	queueDepth   = metrics.NewGauge("grasla_queue_depth", "Renders waiting for a worker.")
+	queueRunning = metrics.NewGauge("grasla_queue_running", "Renders in progress.")
+)
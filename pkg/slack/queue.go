@@ -0,0 +1,141 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/grafana"
+)
+
+var errQueueFull = errors.New("too many graphs are waiting to be rendered, try again later")
+
+// renderTask is a render shared by every identical request submitted before it finishes.
+type renderTask struct {
+	key    string
+	seq    int
+	render func(ctx context.Context) ([]groupGraph, error)
+
+	done   chan struct{}
+	graphs []groupGraph
+	err    error
+}
+
+// wait returns a copy of the rendered graphs, so that each requester can read them.
+func (t *renderTask) wait(ctx context.Context) ([]groupGraph, error) {
+	select {
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	case <-t.done:
+	}
+	if t.err != nil {
+		return nil, t.err
+	}
+	graphs := make([]groupGraph, len(t.graphs))
+	for i, g := range t.graphs {
+		graphs[i] = groupGraph{name: g.name, err: g.err}
+		if g.graph != nil {
+			graphs[i].graph = &grafana.Graph{Graph: bytes.NewBuffer(g.graph.Graph.Bytes()), URL: g.graph.URL}
+		}
+	}
+	return graphs, nil
+}
+
+// renderQueue runs renders on a fixed number of workers. Requests beyond what the
+// workers and the queue can hold are rejected.
+type renderQueue struct {
+	ctx   context.Context
+	tasks chan *renderTask
+	// slots bounds the Grafana renders running at once to the number of workers,
+	// counting each alias of a group.
+	slots chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]*renderTask
+	workers  int
+	busy     int
+	enqueued int
+	started  int
+}
+
+func newRenderQueue(ctx context.Context, workers, maxLength int) *renderQueue {
+	q := &renderQueue{
+		ctx:      ctx,
+		tasks:    make(chan *renderTask, maxLength),
+		slots:    make(chan struct{}, workers),
+		inflight: make(map[string]*renderTask),
+		workers:  workers,
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+func (q *renderQueue) work() {
+	for t := range q.tasks {
+		q.mu.Lock()
+		q.started++
+		q.busy++
+		q.updateGauges()
+		q.mu.Unlock()
+
+		t.graphs, t.err = t.render(q.ctx)
+		close(t.done)
+
+		q.mu.Lock()
+		q.busy--
+		delete(q.inflight, t.key)
+		q.updateGauges()
+		q.mu.Unlock()
+	}
+}
+
+// acquire waits for a render slot and returns the function releasing it.
+func (q *renderQueue) acquire(ctx context.Context) (func(), error) {
+	select {
+	case q.slots <- struct{}{}:
+		return func() { <-q.slots }, nil
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+}
+
+// submit queues render under key unless an identical one is queued or running, and
+// returns the task with its position in the queue, 0 meaning it is being rendered.
+func (q *renderQueue) submit(key string, render func(ctx context.Context) ([]groupGraph, error)) (*renderTask, int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t, ok := q.inflight[key]; ok {
+		return t, q.position(t), nil
+	}
+	if len(q.tasks) == cap(q.tasks) {
+		return nil, 0, errQueueFull
+	}
+	q.enqueued++
+	t := &renderTask{key: key, seq: q.enqueued, render: render, done: make(chan struct{})}
+	q.inflight[key] = t
+	q.tasks <- t
+	q.updateGauges()
+	return t, q.position(t), nil
+}
+
+// updateGauges must be called with mu held.
+func (q *renderQueue) updateGauges() {
+	queueDepth.Set(float64(q.enqueued - q.started))
+	queueRunning.Set(float64(q.busy))
+}
+
+func (q *renderQueue) position(t *renderTask) int {
+	if t.seq <= q.started {
+		return 0
+	}
+	ahead := t.seq - q.started - 1
+	idle := q.workers - q.busy
+	if ahead < idle {
+		return 0
+	}
+	return ahead - idle + 1
+}
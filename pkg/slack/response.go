@@ -0,0 +1,135 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/grafana"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+)
+
+// progressDelay is how long a render may take before the user is told it is still running.
+const progressDelay = 5 * time.Second
+
+// respond posts msg to the response_url of a slash command or an interaction.
+func (s *Slack) respond(ctx context.Context, responseURL string, msg *slack.Msg) error {
+	if responseURL == "" {
+		return nil
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.Current().Slack.UploadTimeout.Duration())
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, responseURL, bytes.NewReader(b))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("response_url: %s", resp.Status)
+	}
+	return nil
+}
+
+// ephemeral is a message only the invoking user sees. It replaces the previous one when replace is set.
+func ephemeral(text string, replace bool) *slack.Msg {
+	return &slack.Msg{
+		ResponseType:    slack.ResponseTypeEphemeral,
+		Text:            text,
+		ReplaceOriginal: replace,
+	}
+}
+
+// reportProgress runs a render and keeps the user informed through responseURL:
+// a notice when it takes longer than progressDelay, the failure reason, the graphs
+// a group was posted without, or the removal of the placeholder message once the
+// graph has been posted.
+// Notices are sent even when the job was abandoned by a shutdown.
+func (s *Slack) reportProgress(reqCtx context.Context, responseURL, name string, replace bool, run func(ctx context.Context) error) {
+	ctx := logging.CopyFields(context.Background(), reqCtx)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(logging.CopyFields(s.ctx, reqCtx))
+	}()
+
+	timer := time.NewTimer(progressDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if err := s.respond(ctx, responseURL, ephemeral(fmt.Sprintf("still rendering %s...", name), replace)); err != nil {
+				logging.Warn(ctx, "cannot report progress", "err", err)
+			}
+		case err := <-done:
+			var msg *slack.Msg
+			var failure *groupFailure
+			if stderrors.As(errors.Cause(err), &failure) {
+				logging.Warn(ctx, "group posted without some graphs", "name", name, "err", err)
+				msg = ephemeral(fmt.Sprintf("%s was posted without some graphs:\n%s", name, failure.Error()), replace)
+			} else if err != nil {
+				logging.Error(ctx, "render failed", "name", name, "err", err)
+				if s.ctx.Err() != nil {
+					msg = ephemeral(fmt.Sprintf("rendering %s was abandoned because the server is shutting down. Please try again in a moment.", name), replace)
+				} else {
+					msg = ephemeral(fmt.Sprintf("failed to render %s: %s", name, errorMessage(err)), replace)
+				}
+			} else if replace {
+				msg = &slack.Msg{DeleteOriginal: true}
+			} else {
+				return
+			}
+			if err := s.respond(ctx, responseURL, msg); err != nil {
+				logging.Warn(ctx, "cannot report the result", "err", err)
+			}
+			return
+		}
+	}
+}
+
+// errorMessage describes err for users without the wrapping context.
+func errorMessage(err error) string {
+	cause := errors.Cause(err)
+	switch {
+	case stderrors.Is(cause, context.DeadlineExceeded):
+		return "it took too long and was given up. Try a shorter time range."
+	case stderrors.Is(cause, context.Canceled):
+		return "it was canceled."
+	}
+	e, ok := cause.(*grafana.Error)
+	if !ok {
+		return cause.Error()
+	}
+	switch e.Kind {
+	case grafana.ErrUnauthorized:
+		return fmt.Sprintf("Grafana rejected the credentials (%s). Check the API key or the client certificate.", e.Message)
+	case grafana.ErrNotFound:
+		return "Grafana returned 404. The dashboard or panel of this alias may have been removed or moved."
+	case grafana.ErrRendererUnavailable:
+		return fmt.Sprintf("Grafana returned %d. The image renderer may be down or not installed.", e.StatusCode)
+	case grafana.ErrTimeout:
+		return "rendering timed out. Try a shorter time range or a longer `timeout=`."
+	case grafana.ErrNotImage:
+		return fmt.Sprintf("Grafana did not return an image (%s).", e.Message)
+	case grafana.ErrUnreachable:
+		return "Grafana is unreachable."
+	case grafana.ErrCanceled:
+		return "it was canceled."
+	}
+	return fmt.Sprintf("Grafana returned %d.", e.StatusCode)
+}
@@ -0,0 +1,66 @@
+package slack
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/retry"
+)
+
+// call runs the Slack API method with the upload timeout on each attempt, retrying it
+// when Slack is rate limiting or cannot be connected to.
+func (s *Slack) call(ctx context.Context, method string, fn func(ctx context.Context) error) error {
+	err := s.retryPolicy().Do(ctx, retryable(method), func() error {
+		ctx, cancel := context.WithTimeout(ctx, config.Current().Slack.UploadTimeout.Duration())
+		defer cancel()
+		return fn(ctx)
+	})
+	if err != nil {
+		slackFailures.Inc(method)
+	}
+	return err
+}
+
+// lookupTimeout bounds a Slack lookup made while answering a slash command, which Slack
+// gives up on after 3 seconds.
+const lookupTimeout = time.Second
+
+// lookup runs a Slack API method needed to answer a slash command: once, with the lookup
+// timeout, since waiting for retries would make Slack drop the command.
+func (s *Slack) lookup(ctx context.Context, method string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	err := fn(ctx)
+	if err != nil {
+		slackFailures.Inc(method)
+	}
+	return err
+}
+
+// retryable accepts failures where Slack did not handle the request, so that retrying
+// does not post twice: rate limits and connections that could not be made. A 5xx status
+// may come after Slack posted, so it is only retried for chat.update, which repeats safely.
+func retryable(method string) retry.Retryable {
+	return func(err error) (bool, time.Duration) {
+		cause := errors.Cause(err)
+		if e, ok := cause.(*slack.RateLimitedError); ok {
+			return true, e.RetryAfter
+		}
+		if e, ok := cause.(interface{ HTTPStatusCode() int }); ok {
+			code := e.HTTPStatusCode()
+			return code == http.StatusTooManyRequests || (code >= 500 && method == "chat.update"), 0
+		}
+		var opErr *net.OpError
+		if stderrors.As(cause, &opErr) && opErr.Op == "dial" {
+			return true, 0
+		}
+		return false, 0
+	}
+}
@@ -0,0 +1,42 @@
+package slack
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// statusError is like the error of the Slack client for a non-200 status.
+type statusError int
+
+func (e statusError) Error() string       { return "slack server error" }
+func (e statusError) HTTPStatusCode() int { return int(e) }
+
+func TestRetryable(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		method string
+		err    error
+		want   bool
+	}{
+		{"files.upload", &slack.RateLimitedError{RetryAfter: time.Second}, true},
+		{"files.upload", statusError(429), true},
+		{"files.upload", statusError(502), false},
+		{"chat.postMessage", statusError(500), false},
+		{"chat.update", statusError(500), true},
+		{"chat.update", statusError(400), false},
+		{"files.upload", dial, true},
+		{"files.upload", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, false},
+	}
+	for _, tt := range tests {
+		if got, _ := retryable(tt.method)(tt.err); got != tt.want {
+			t.Errorf("retryable(%s)(%v) = %t, want %t", tt.method, tt.err, got, tt.want)
+		}
+	}
+	if _, wait := retryable("files.upload")(&slack.RateLimitedError{RetryAfter: 3 * time.Second}); wait != 3*time.Second {
+		t.Errorf("wait = %s, want Retry-After", wait)
+	}
+}
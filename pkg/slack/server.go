@@ -1,13 +1,14 @@
 package slack
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/nlopes/slack"
@@ -15,6 +16,9 @@ import (
 
 	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/config"
 	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/grafana"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/logging"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/metrics"
+	"github.com/LifeMemoryTeam/slack-grafana-image-renderer-picker/pkg/retry"
 )
 
 const (
@@ -22,23 +26,49 @@ const (
 )
 
 type Slack struct {
-	Token   string
-	Secret  string
-	grafana *grafana.Client
+	grafana grafana.Backends
 
-	slack  *slack.Client
 	server *http.Server
+	images *imageStore
+	queue  *renderQueue
+	health healthCache
+
+	// mu guards the settings a config reload may change.
+	mu     sync.RWMutex
+	secret string
+	slack  *slack.Client
+	retry  retry.Policy
+
+	usergroups usergroupCache
+	timezones  timezoneCache
+
+	// ctx is canceled to abandon the jobs still running when the grace period is over.
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   sync.WaitGroup
 }
 
-func NewSlackServer(grafana *grafana.Client, token, secret, addr string) *Slack {
+// abandonTimeout is how long abandoned jobs are given to tell their users.
+const abandonTimeout = 5 * time.Second
+
+func NewSlackServer(grafana grafana.Backends, token, secret, addr string) *Slack {
 	s := &Slack{}
 	s.grafana = grafana
-	s.Token = token
-	s.Secret = secret
+	s.secret = secret
 	s.slack = slack.New(token)
+	c := config.Current()
+	s.images = newImageStore(c.Slack.ImageTTL.Duration(), c.Slack.ImageMaxEntries, int64(c.Slack.ImageMaxSizeMB)<<20)
+	s.retry = config.Current().Retry.Slack.Policy()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.queue = newRenderQueue(s.ctx, config.Current().Queue.Workers, config.Current().Queue.MaxLength)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/slash", s.slashHandler)
+	mux.HandleFunc("/interactions", s.interactionHandler)
+	mux.Handle(imagePath, s.images)
+	mux.HandleFunc("/healthz", s.healthzHandler)
+	mux.HandleFunc("/readyz", s.readyzHandler)
+	mux.Handle("/metrics", metrics.Handler())
 	s.server = &http.Server{
 		Addr:    addr,
 		Handler: mux,
@@ -47,12 +77,80 @@ func NewSlackServer(grafana *grafana.Client, token, secret, addr string) *Slack
 	return s
 }
 
+// Reload applies the Slack settings of a reloaded config.
+func (s *Slack) Reload(c *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secret = c.Slack.Secret
+	s.slack = slack.New(c.Slack.Token)
+	s.retry = c.Retry.Slack.Policy()
+}
+
+// api returns the Slack client for the current token.
+func (s *Slack) api() *slack.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.slack
+}
+
+func (s *Slack) signingSecret() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.secret
+}
+
+func (s *Slack) retryPolicy() retry.Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retry
+}
+
 func (s *Slack) Start() error {
-	return s.server.ListenAndServe()
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for the queued and running jobs until
+// grace is over. The remaining jobs are then canceled and their users told so.
+func (s *Slack) Shutdown(grace time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return errors.WithStack(err)
+	case <-ctx.Done():
+	}
+
+	logging.Warn(context.Background(), "grace period is over, abandoning the remaining jobs")
+	s.cancel()
+	select {
+	case <-done:
+	case <-time.After(abandonTimeout):
+	}
+	return errors.WithStack(err)
+}
+
+// startJob runs a job in the background with its progress reported to responseURL.
+// It is logged with the fields of the request context ctx. Shutdown waits for it.
+func (s *Slack) startJob(ctx context.Context, responseURL, name string, replace bool, run func(ctx context.Context) error) {
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		s.reportProgress(ctx, responseURL, name, replace, run)
+	}()
 }
 
 func (s *Slack) slashHandler(w http.ResponseWriter, r *http.Request) {
-	verifier, err := slack.NewSecretsVerifier(r.Header, s.Secret)
+	verifier, err := slack.NewSecretsVerifier(r.Header, s.signingSecret())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -70,47 +168,21 @@ func (s *Slack) slashHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println(slackRes)
+	ctx := logging.WithFields(r.Context(),
+		"request_id", logging.NewRequestID(),
+		"team", slackRes.TeamID,
+		"channel", slackRes.ChannelID,
+		"user", slackRes.UserID,
+	)
+	r = r.WithContext(ctx)
+	logging.Info(ctx, "slash command", "command", slackRes.Command, "text", slackRes.Text)
 
 	switch slackRes.Command {
 	case InvokeSlackGrafanaImageRenderCommand:
-		args := strings.Split(slackRes.Text, " ")
-		var from string
-		if len(args) >= 2 {
-			from, err = grafana.ParseTimeRange(args[1])
-			if err != nil {
-				s.responseWithMessage("time range is invalid", w)
-				return
-			}
-		}
-
-		if _, err := config.GetDashboard(args[0]); err != nil {
-			s.responseWithMessage("no graph", w)
-			return
-		} else {
-			go func() {
-				graph, err := s.getGraphDsolo(args[0], from)
-				if err != nil {
-					log.Println(err)
-					return
-				}
-				if err := s.uploadGraph(slackRes.ChannelID, graph); err != nil {
-					log.Println(err)
-				}
-			}()
-			s.responseWithMessage("taking graph...", w)
-		}
-
+		s.dispatch(w, r, slackRes)
 	}
 }
 
-func (s *Slack) getGraphDsolo(graphName, from string) (*grafana.Graph, error) {
-	if from == "" {
-		return s.grafana.GetDsolo(graphName)
-	}
-	return s.grafana.GetDsolo(graphName, grafana.From(from), grafana.To("now"))
-}
-
 func (s *Slack) responseWithMessage(message string, w http.ResponseWriter) {
 	params := &slack.Msg{}
 	params.Text = message
@@ -123,17 +195,29 @@ func (s *Slack) responseWithMessage(message string, w http.ResponseWriter) {
 	w.Write(b)
 }
 
-func (s *Slack) uploadGraph(channel string, graph *grafana.Graph) error {
+func (s *Slack) uploadGraph(ctx context.Context, channel string, graph *grafana.Graph) error {
+	_, err := s.uploadImage(ctx, []string{channel}, graph.URL, graph.Graph.Bytes())
+	return err
+}
+
+// uploadImage uploads a PNG. Without channels the file stays private until its permalink is posted.
+func (s *Slack) uploadImage(ctx context.Context, channels []string, comment string, data []byte) (*slack.File, error) {
 	name := fmt.Sprintf("graph_%d.png", time.Now().UnixNano())
-	params := slack.FileUploadParameters{
-		InitialComment: graph.URL,
-		Reader:         graph.Graph,
-		Filename:       name,
-		Channels:       []string{channel},
-	}
-	_, err := s.slack.UploadFile(params)
-	if err != nil {
+	var file *slack.File
+	err := s.call(ctx, "files.upload", func(ctx context.Context) error {
+		params := slack.FileUploadParameters{
+			InitialComment: comment,
+			Reader:         bytes.NewReader(data),
+			Filename:       name,
+			Channels:       channels,
+		}
+		var err error
+		file, err = s.api().UploadFileContext(ctx, params)
 		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	logging.Debug(ctx, "uploaded", "file", file.ID, "bytes", len(data))
+	return file, nil
 }
@@ -0,0 +1,55 @@
+package slack
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// timezoneTTL is how long the timezone of a user is kept.
+const timezoneTTL = time.Hour
+
+type userTimezone struct {
+	tz      string
+	expires time.Time
+}
+
+// timezoneCache keeps the Slack timezones of the users rendering graphs.
+type timezoneCache struct {
+	mu    sync.Mutex
+	users map[string]userTimezone
+}
+
+// userTimezone returns the timezone set in the Slack profile of the user, looking it up
+// once per timezoneTTL.
+func (s *Slack) userTimezone(ctx context.Context, userID string) (string, error) {
+	s.timezones.mu.Lock()
+	u, ok := s.timezones.users[userID]
+	s.timezones.mu.Unlock()
+	if ok && time.Now().Before(u.expires) {
+		return u.tz, nil
+	}
+
+	var tz string
+	err := s.lookup(ctx, "users.info", func(ctx context.Context) error {
+		user, err := s.api().GetUserInfoContext(ctx, userID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		tz = user.TZ
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.timezones.mu.Lock()
+	defer s.timezones.mu.Unlock()
+	if s.timezones.users == nil {
+		s.timezones.users = make(map[string]userTimezone)
+	}
+	s.timezones.users[userID] = userTimezone{tz: tz, expires: time.Now().Add(timezoneTTL)}
+	return tz, nil
+}